@@ -1,11 +1,20 @@
 module github.com/go-various/redisplus
 
-go 1.15
+go 1.18
 
 require (
+	github.com/alicebob/miniredis/v2 v2.39.0
 	github.com/google/uuid v1.1.2
 	github.com/hashicorp/go-hclog v1.1.0
+	gopkg.in/redis.v5 v5.2.9
+)
+
+require (
+	github.com/fatih/color v1.7.0 // indirect
+	github.com/mattn/go-colorable v0.1.4 // indirect
+	github.com/mattn/go-isatty v0.0.10 // indirect
 	github.com/onsi/ginkgo v1.14.2 // indirect
 	github.com/onsi/gomega v1.10.4 // indirect
-	gopkg.in/redis.v5 v5.2.9
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f // indirect
 )
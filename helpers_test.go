@@ -0,0 +1,111 @@
+package redisplus
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+//newTestView 使用内嵌的 miniredis 创建 view, 完整前缀为 TEST:dev
+func newTestView(t *testing.T) (*miniredis.Miniredis, RedisCli) {
+	s := miniredis.RunT(t)
+	view, err := NewRedisCli(&Config{Addrs: []string{s.Addr()}, KeyPrefix: "TEST"}, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, view
+}
+
+//newTestKeyspace 创建 keyspace 通知, 默认重试策略为 1m, 2m
+func newTestKeyspace(t *testing.T, opts ...NotificationOption) (*miniredis.Miniredis, *notification) {
+	s, view := newTestView(t)
+	opts = append([]NotificationOption{WithPolicies(time.Minute, 2*time.Minute)}, opts...)
+	n, err := newNotification("order", view, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, n
+}
+
+//fireNotifications 删除所有通知 key 并发布 expired 事件, 模拟通知到期
+func fireNotifications(s *miniredis.Miniredis) {
+	for _, key := range s.Keys() {
+		if strings.Contains(key, ":"+NotifyKeyPrefix+":") && !strings.Contains(key, NotifyLockPrefix) {
+			s.Del(key)
+			s.Publish("__keyspace@0__:"+key, "expired")
+		}
+	}
+}
+
+//receiveDelivery 等待 handler 收到通知
+func receiveDelivery(t *testing.T, ch <-chan *Delivery) *Delivery {
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(3 * time.Second):
+		t.Fatal("notification not received")
+		return nil
+	}
+}
+
+//waitFor 等待异步处理的结果
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 150; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+//manualClock 测试使用的时钟, 只在调用 advance 或直接修改 now 时前进
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+//advance 在订阅运行期间推进时间
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+//commandStub 记录 miniredis 不支持的命令收到的参数
+type commandStub struct {
+	mu   sync.Mutex
+	args []string
+}
+
+//stubCommand miniredis 不支持 name 时注册一个记录参数并由 reply 写入结果的实现, 已支持时返回 nil
+func stubCommand(s *miniredis.Miniredis, name string, reply func(peer *server.Peer)) *commandStub {
+	c := &commandStub{}
+	err := s.Server().Register(name, func(peer *server.Peer, cmd string, args []string) {
+		c.mu.Lock()
+		c.args = args
+		c.mu.Unlock()
+		reply(peer)
+	})
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+//lastArgs 最后一次调用的参数, 不含命令名
+func (c *commandStub) lastArgs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.args
+}
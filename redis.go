@@ -1,6 +1,7 @@
 package redisplus
 
 import (
+	"context"
 	"crypto/tls"
 	"gopkg.in/redis.v5"
 	"time"
@@ -33,11 +34,50 @@ type RedisCli interface {
 
 	// SetNX Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
 	SetNX(key string, value []byte, duration string) (bool, error)
+	SetNXDuration(key string, value []byte, ttl time.Duration) (bool, error)
+	SetNXNoTTL(key string, value []byte) (bool, error)
 	Get(key string) ([]byte, error)
 	// Set Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
 	Set(key string, value []byte, duration string) error
+	SetDuration(key string, value []byte, ttl time.Duration) error
+	SetNoTTL(key string, value []byte) error
 	Del(keys ...string) (int64, error)
 	Expire(key string, duration string) error
+	ExpireDuration(key string, ttl time.Duration) error
+	Incr(key string) (int64, error)
+	IncrBy(key string, value int64) (int64, error)
+	IncrByFloat(key string, value float64) (float64, error)
+	Decr(key string) (int64, error)
+	DecrBy(key string, value int64) (int64, error)
+	MGet(keys ...string) ([][]byte, error)
+	MSet(values map[string][]byte) error
+	MSetNX(values map[string][]byte) (bool, error)
+	GetSet(key string, value []byte) ([]byte, error)
+	GetDel(key string) ([]byte, error)
+	// GetEx Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+	GetEx(key string, duration string) ([]byte, error)
+	GetExDuration(key string, ttl time.Duration) ([]byte, error)
+	GetExPersist(key string) ([]byte, error)
+	Append(key string, value []byte) (int64, error)
+	GetRange(key string, start, end int64) ([]byte, error)
+	SetRange(key string, offset int64, value []byte) (int64, error)
+	StrLen(key string) (int64, error)
+	// SetXX Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+	SetXX(key string, value []byte, duration string) (bool, error)
+	SetXXDuration(key string, value []byte, ttl time.Duration) (bool, error)
+	SetXXNoTTL(key string, value []byte) (bool, error)
+	SetKeepTTL(key string, value []byte) error
+	TTL(key string) (time.Duration, error)
+	PTTL(key string) (time.Duration, error)
+	Persist(key string) (bool, error)
+	ExpireAt(key string, at time.Time) (bool, error)
+	Exists(keys ...string) (int64, error)
+	Type(key string) (string, error)
+	Rename(key, newKey string) error
+	RenameNX(key, newKey string) (bool, error)
+	Copy(key, destination string, replace bool) (bool, error)
+	Touch(keys ...string) (int64, error)
+	Unlink(keys ...string) (int64, error)
 	HSetNX(key, field string, value []byte) error
 	HSet(key, field string, value []byte) error
 	HMSet(key string, Values map[string][]byte) error
@@ -49,6 +89,11 @@ type RedisCli interface {
 	HKeys(key string) ([]string, error)
 	HValues(key string) ([][]byte, error)
 	HExists(key, field string) (bool, error)
+	HIncrBy(key, field string, incr int64) (int64, error)
+	HIncrByFloat(key, field string, incr float64) (float64, error)
+	HStrLen(key, field string) (int64, error)
+	HRandField(key string, count int64, withValues bool) ([]*HashField, error)
+	HScan(key string, cursor uint64, match string, count int64) (map[string][]byte, uint64, error)
 	LRem(key string, count int64, value []byte) (int64, error)
 	LIndex(key string, index int64) ([]byte, error)
 	LTrim(key string, start, stop int64) error
@@ -60,6 +105,13 @@ type RedisCli interface {
 	LRange(key string, start, stop int64) ([][]byte, error)
 	LLen(key string) (int64, error)
 	LInsert(key string, op InsertOP, pivot, value []byte) (int64, error)
+	LPos(key string, value []byte, rank int64) (int64, error)
+	LMove(source, destination string, from, to ListSide) ([]byte, error)
+	RPopLPush(source, destination string) ([]byte, error)
+	BLPop(ctx context.Context, keys ...string) (string, []byte, error)
+	BRPop(ctx context.Context, keys ...string) (string, []byte, error)
+	BLMove(ctx context.Context, source, destination string, from, to ListSide) ([]byte, error)
+	BRPopLPush(ctx context.Context, source, destination string) ([]byte, error)
 	SLen(key string) (int64, error)
 	SAdd(key string, values ...[]byte) (int64, error)
 	SRem(key string, values ...[]byte) (int64, error)
@@ -71,6 +123,12 @@ type RedisCli interface {
 	SInterMerge(destination string, keys ...string) (int64, error)
 	SUnion(keys ...string) ([][]byte, error)
 	SUnionMerge(destination string, keys ...string) (int64, error)
+	SMembers(key string) ([][]byte, error)
+	SIsMember(key string, member []byte) (bool, error)
+	SMIsMember(key string, members ...[]byte) ([]bool, error)
+	SRandMember(key string, count int64) ([][]byte, error)
+	SMove(source, destination string, member []byte) (bool, error)
+	SScan(key string, cursor uint64, match string, count int64) ([][]byte, uint64, error)
 	ZLen(key string) (int64, error)
 	ZCount(key string, min, max float64) (int64, error)
 	ZLexCount(key, min, max string) (int64, error)
@@ -93,6 +151,22 @@ type RedisCli interface {
 
 	ZInterMerge(destination string, merge *ZMerge, keys ...string) (int64, error)
 	ZUnionMerge(destination string, merge *ZMerge, keys ...string) (int64, error)
+	ZScore(key string, member []byte) (float64, error)
+	ZMScore(key string, members ...[]byte) ([]*float64, error)
+	ZPopMin(key string, count int64) ([]*ZMember, error)
+	ZPopMax(key string, count int64) ([]*ZMember, error)
+	BZPopMin(ctx context.Context, keys ...string) (string, *ZMember, error)
+	BZPopMax(ctx context.Context, keys ...string) (string, *ZMember, error)
+	ZRandMember(key string, count int64, withScores bool) ([]*ZMember, error)
+	ZRangeStore(destination, key string, start, stop int64) (int64, error)
+
+	SetBit(key string, offset int64, value int) (int64, error)
+	GetBit(key string, offset int64) (int64, error)
+	BitCount(key string) (int64, error)
+	BitCountRange(key string, start, end int64) (int64, error)
+	BitOp(op BitOP, destination string, keys ...string) (int64, error)
+	BitPos(key string, bit int64, pos ...int64) (int64, error)
+	BitField(key string, ops ...BitFieldOp) ([]*int64, error)
 
 	GeoAdd(key string, geoLocation ...*redis.GeoLocation) (int64, error)
 	GeoRadius(key string, longitude, latitude float64, query *redis.GeoRadiusQuery) ([]redis.GeoLocation, error)
@@ -115,11 +189,42 @@ const (
 	InsertOP_AFTER  InsertOP = 1
 )
 
+// BitOP BitOp 的位运算
+type BitOP int32
+
+const (
+	BitOP_AND BitOP = 0
+	BitOP_OR  BitOP = 1
+	BitOP_XOR BitOP = 2
+	BitOP_NOT BitOP = 3
+)
+
+// ListSide LMove/BLMove 弹出与写入的位置
+type ListSide int32
+
+const (
+	ListSide_LEFT  ListSide = 0
+	ListSide_RIGHT ListSide = 1
+)
+
+func (s ListSide) String() string {
+	if s == ListSide_RIGHT {
+		return "RIGHT"
+	}
+	return "LEFT"
+}
+
 type RedisEntry struct {
 	Key   string `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
 	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
 }
 
+// HashField HRandField 的结果
+type HashField struct {
+	Field string
+	Value []byte
+}
+
 // ZMember map
 type ZMember struct {
 	Score  float64 `protobuf:"fixed32,1,opt,name=score,proto3" json:"score,omitempty"`
@@ -0,0 +1,132 @@
+package redisplus
+
+import (
+	"errors"
+	"gopkg.in/redis.v5"
+)
+
+var errBitOpNot = errors.New("bitop NOT requires exactly one source key")
+var errBitOpUnknown = errors.New("unknown bitop operation")
+
+// BitFieldOp BITFIELD 的子命令, 使用 BitFieldGet 等函数创建
+type BitFieldOp struct {
+	args []interface{}
+}
+
+// BitFieldGet 读取 encoding(如 u8, i16) 类型的整数, offset 为位偏移或 "#n" 表示第 n 个该类型整数
+func BitFieldGet(encoding, offset string) BitFieldOp {
+	return BitFieldOp{args: []interface{}{"get", encoding, offset}}
+}
+
+// BitFieldSet 写入整数, 结果为原值
+func BitFieldSet(encoding, offset string, value int64) BitFieldOp {
+	return BitFieldOp{args: []interface{}{"set", encoding, offset, value}}
+}
+
+// BitFieldIncrBy 增加整数, 结果为新值
+func BitFieldIncrBy(encoding, offset string, increment int64) BitFieldOp {
+	return BitFieldOp{args: []interface{}{"incrby", encoding, offset, increment}}
+}
+
+// BitFieldOverflow 设置之后的 SET/INCRBY 的溢出方式: WRAP, SAT 或 FAIL, 没有结果
+func BitFieldOverflow(mode string) BitFieldOp {
+	return BitFieldOp{args: []interface{}{"overflow", mode}}
+}
+
+func (r *redisView) SetBit(key string, offset int64, value int) (int64, error) {
+	result, err := r.cmd.SetBit(r.expandKey(key), offset, value).Result()
+	if nil != err {
+		return 0, wrapError("setbit", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) GetBit(key string, offset int64) (int64, error) {
+	result, err := r.cmd.GetBit(r.expandKey(key), offset).Result()
+	if nil != err {
+		return 0, wrapError("getbit", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// BitCount 统计值为 1 的位数
+func (r *redisView) BitCount(key string) (int64, error) {
+	result, err := r.cmd.BitCount(r.expandKey(key), nil).Result()
+	if nil != err {
+		return 0, wrapError("bitcount", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// BitCountRange 统计 [start, end] 字节范围内值为 1 的位数, 负数表示从末尾开始
+func (r *redisView) BitCountRange(key string, start, end int64) (int64, error) {
+	bitCount := &redis.BitCount{Start: start, End: end}
+	result, err := r.cmd.BitCount(r.expandKey(key), bitCount).Result()
+	if nil != err {
+		return 0, wrapError("bitcount", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// BitOp destination 与 keys 使用相同的前缀, 集群模式下必须在同一个 slot, 返回 destination 的字节长度
+func (r *redisView) BitOp(op BitOP, destination string, keys ...string) (int64, error) {
+	switch op {
+	case BitOP_AND, BitOP_OR, BitOP_XOR:
+	case BitOP_NOT:
+		if len(keys) != 1 {
+			return 0, errBitOpNot
+		}
+	default:
+		return 0, errBitOpUnknown
+	}
+	dest, inKeys := r.expandKey(destination), r.expandKeys(keys)
+	if err := r.sameSlot(append([]string{dest}, inKeys...)...); err != nil {
+		return 0, err
+	}
+	var cmd *redis.IntCmd
+	switch op {
+	case BitOP_AND:
+		cmd = r.cmd.BitOpAnd(dest, inKeys...)
+	case BitOP_OR:
+		cmd = r.cmd.BitOpOr(dest, inKeys...)
+	case BitOP_XOR:
+		cmd = r.cmd.BitOpXor(dest, inKeys...)
+	case BitOP_NOT:
+		cmd = r.cmd.BitOpNot(dest, inKeys[0])
+	}
+	result, err := cmd.Result()
+	if nil != err {
+		return 0, wrapError("bitop", dest, err)
+	}
+	return result, nil
+}
+
+// BitPos 返回第一个值为 bit 的位偏移, pos 为可选的起止字节, 不存在时返回 -1
+func (r *redisView) BitPos(key string, bit int64, pos ...int64) (int64, error) {
+	result, err := r.cmd.BitPos(r.expandKey(key), bit, pos...).Result()
+	if nil != err {
+		return 0, wrapError("bitpos", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// BitField 按顺序执行子命令, 每个 GET/SET/INCRBY 对应一个结果, OVERFLOW FAIL 时结果为 nil, 需要 redis 3.2
+func (r *redisView) BitField(key string, ops ...BitFieldOp) ([]*int64, error) {
+	args := []interface{}{"bitfield", r.expandKey(key)}
+	for _, op := range ops {
+		args = append(args, op.args...)
+	}
+	cmd := redis.NewSliceCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("bitfield", r.expandKey(key), err)
+	}
+	result := cmd.Val()
+	out := make([]*int64, len(result))
+	for i, value := range result {
+		if v, ok := value.(int64); ok {
+			out[i] = &v
+		}
+	}
+	return out, nil
+}
+
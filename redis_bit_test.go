@@ -0,0 +1,128 @@
+package redisplus
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestBitCommands(t *testing.T) {
+	s, view := newTestView(t)
+	cases := []struct {
+		name string
+		call func() (int64, error)
+		want int64
+	}{
+		{"setbit", func() (int64, error) { return view.SetBit("a", 7, 1) }, 0},
+		{"setbit again", func() (int64, error) { return view.SetBit("a", 7, 1) }, 1},
+		{"getbit", func() (int64, error) { return view.GetBit("a", 7) }, 1},
+		{"getbit unset", func() (int64, error) { return view.GetBit("a", 3) }, 0},
+		{"setbit b", func() (int64, error) { return view.SetBit("b", 9, 1) }, 0},
+		{"bitcount", func() (int64, error) { return view.BitCount("a") }, 1},
+		{"bitcount range", func() (int64, error) { return view.BitCountRange("b", 1, 1) }, 1},
+		{"bitpos", func() (int64, error) { return view.BitPos("b", 1) }, 9},
+		{"bitop or", func() (int64, error) { return view.BitOp(BitOP_OR, "c", "a", "b") }, 2},
+		{"bitcount or", func() (int64, error) { return view.BitCount("c") }, 2},
+		{"bitop not", func() (int64, error) { return view.BitOp(BitOP_NOT, "d", "a") }, 1},
+		{"bitcount not", func() (int64, error) { return view.BitCount("d") }, 7},
+	}
+	for _, c := range cases {
+		got, err := c.call()
+		if err != nil || got != c.want {
+			t.Fatalf("%s: got %d %v, want %d", c.name, got, err, c.want)
+		}
+	}
+	if !s.Exists("TEST:dev:c") || !s.Exists("TEST:dev:d") {
+		t.Fatal(s.Keys())
+	}
+	if _, err := view.BitOp(BitOP_NOT, "d", "a", "b"); err != errBitOpNot {
+		t.Fatal(err)
+	}
+	if _, err := view.BitOp(BitOP(9), "e", "a"); err != errBitOpUnknown || s.Exists("TEST:dev:e") {
+		t.Fatal(err)
+	}
+}
+
+//TestBitField miniredis 不支持 BITFIELD 时检查发出的参数与结果的映射
+func TestBitField(t *testing.T) {
+	s, view := newTestView(t)
+	stub := stubCommand(s, "BITFIELD", func(peer *server.Peer) {
+		peer.WriteLen(3)
+		peer.WriteInt(0)
+		peer.WriteNull()
+		peer.WriteInt(255)
+	})
+	got, err := view.BitField("bf",
+		BitFieldSet("u8", "0", 255),
+		BitFieldOverflow("FAIL"),
+		BitFieldIncrBy("u8", "0", 1),
+		BitFieldGet("u8", "0"),
+	)
+	if err != nil || len(got) != 3 {
+		t.Fatal(got, err)
+	}
+	if stub != nil {
+		want := []string{"TEST:dev:bf", "set", "u8", "0", "255", "overflow", "FAIL", "incrby", "u8", "0", "1", "get", "u8", "0"}
+		if args := stub.lastArgs(); !reflect.DeepEqual(args, want) {
+			t.Fatal(args)
+		}
+	}
+	//OVERFLOW FAIL 时 INCRBY 的结果为 nil
+	if got[0] == nil || *got[0] != 0 || got[1] != nil || got[2] == nil || *got[2] != 255 {
+		t.Fatal(got)
+	}
+}
+
+func TestBitset(t *testing.T) {
+	s, view := newTestView(t)
+	users := NewBitset(view, "dau")
+	day1 := DayBucket(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC))
+	day2 := DayBucket(time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC))
+	if day1 != "20240102" {
+		t.Fatal(day1)
+	}
+	for _, id := range []int64{1, 5, 1000} {
+		users.Mark(day1, id)
+	}
+	for _, id := range []int64{5, 1000, 2000} {
+		users.Mark(day2, id)
+	}
+	if old, err := users.Mark(day1, 5); err != nil || !old {
+		t.Fatal(old, err)
+	}
+	if ok, _ := users.IsMarked(day2, 1); ok {
+		t.Fatal("id 1 marked on day2")
+	}
+	if n, err := users.Count(day1); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if n, err := users.And("retained", day1, day2); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if n, err := users.Or("active", day1, day2); err != nil || n != 4 {
+		t.Fatal(n, err)
+	}
+	if _, err := users.Mark(day1, -1); err != errBitsetID {
+		t.Fatal(err)
+	}
+	if _, err := users.And("x"); err != errBucketsEmpty {
+		t.Fatal(err)
+	}
+	for _, key := range s.Keys() {
+		if KeySlot(key) != KeySlot("{dau}") {
+			t.Fatal("bucket is not in the bitset slot", key)
+		}
+	}
+	if err := users.Expire(day1, time.Hour); err != nil || s.TTL("TEST:dev:{dau}:"+day1) != time.Hour {
+		t.Fatal(err)
+	}
+	if n, err := users.Delete(day1, day2, "retained", "active"); err != nil || n != 4 {
+		t.Fatal(n, err)
+	}
+	if _, err := view.Get("{dau}:" + day1); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+// bitset helper for daily-active-user style tracking
+
+package redisplus
+
+import (
+	"errors"
+	"time"
+)
+
+// maxBitOffset redis 位图的最大位偏移
+const maxBitOffset = 1<<32 - 1
+
+// BucketDayLayout DayBucket 的格式
+const BucketDayLayout = "20060102"
+
+var errBitsetID = errors.New("bitset id must be between 0 and 2^32-1")
+var errBucketsEmpty = errors.New("buckets must be not empty")
+
+// DayBucket 返回 t 所在日期的 bucket, 例如 20240102
+func DayBucket(t time.Time) string {
+	return t.Format(BucketDayLayout)
+}
+
+// Bitset 按 bucket(例如日期) 记录 ID 是否出现的位图, ID 即位偏移.
+// 同一个 Bitset 的所有 bucket 使用 {name} 作为 hash tag, 集群模式下 BITOP 可以跨 bucket 执行
+type Bitset struct {
+	cache RedisCli
+	name  string
+}
+
+// NewBitset 创建位图, name 不包含前缀
+func NewBitset(cache RedisCli, name string) *Bitset {
+	return &Bitset{cache: cache, name: name}
+}
+
+//key 不包含前缀的 bucket key
+func (b *Bitset) key(bucket string) string {
+	return companionKey(b.name, bucket)
+}
+
+func (b *Bitset) keys(buckets []string) []string {
+	keys := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		keys = append(keys, b.key(bucket))
+	}
+	return keys
+}
+
+func checkBitsetID(id int64) error {
+	if id < 0 || id > maxBitOffset {
+		return errBitsetID
+	}
+	return nil
+}
+
+// Mark 标记 id, 返回之前是否已标记
+func (b *Bitset) Mark(bucket string, id int64) (bool, error) {
+	if err := checkBitsetID(id); nil != err {
+		return false, err
+	}
+	old, err := b.cache.SetBit(b.key(bucket), id, 1)
+	return old == 1, err
+}
+
+// Unmark 取消标记 id, 返回之前是否已标记
+func (b *Bitset) Unmark(bucket string, id int64) (bool, error) {
+	if err := checkBitsetID(id); nil != err {
+		return false, err
+	}
+	old, err := b.cache.SetBit(b.key(bucket), id, 0)
+	return old == 1, err
+}
+
+// IsMarked 返回 id 是否已标记
+func (b *Bitset) IsMarked(bucket string, id int64) (bool, error) {
+	if err := checkBitsetID(id); nil != err {
+		return false, err
+	}
+	bit, err := b.cache.GetBit(b.key(bucket), id)
+	return bit == 1, err
+}
+
+// Count 返回 bucket 中已标记的 id 数量
+func (b *Bitset) Count(bucket string) (int64, error) {
+	return b.cache.BitCount(b.key(bucket))
+}
+
+// And 将所有 buckets 中都标记的 id 写入 destination, 返回 destination 的 id 数量
+func (b *Bitset) And(destination string, buckets ...string) (int64, error) {
+	return b.merge(BitOP_AND, destination, buckets)
+}
+
+// Or 将任一 buckets 中标记的 id 写入 destination, 返回 destination 的 id 数量
+func (b *Bitset) Or(destination string, buckets ...string) (int64, error) {
+	return b.merge(BitOP_OR, destination, buckets)
+}
+
+func (b *Bitset) merge(op BitOP, destination string, buckets []string) (int64, error) {
+	if 0 == len(buckets) {
+		return 0, errBucketsEmpty
+	}
+	if _, err := b.cache.BitOp(op, b.key(destination), b.keys(buckets)...); nil != err {
+		return 0, err
+	}
+	return b.Count(destination)
+}
+
+// Expire 设置 bucket 的过期时间
+func (b *Bitset) Expire(bucket string, ttl time.Duration) error {
+	return b.cache.ExpireDuration(b.key(bucket), ttl)
+}
+
+// Delete 删除 buckets
+func (b *Bitset) Delete(buckets ...string) (int64, error) {
+	return b.cache.Del(b.keys(buckets)...)
+}
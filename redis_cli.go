@@ -10,17 +10,33 @@ import (
 var ErrorResultNotOK = errors.New("result is not OK")
 var ErrorResultNotTrue = errors.New("result is not true")
 var ErrorInputValuesIsNil = errors.New("input values is nil")
+var ErrorDurationEmpty = errors.New("duration is empty and no default ttl")
+var ErrorDurationNegative = errors.New("duration is negative")
 
 
 var _ RedisCli = (*redisView)(nil)
 
 type redisView struct {
-	prefix string
-	cmd    RedisCmd
-	pubSub redis.PubSub
+	prefix  string
+	cmd     RedisCmd
+	pubSub  redis.PubSub
+	cluster bool //多 key 命令按 slot 拆分
+	//defaultTTL 写入命令未指定过期时间时使用, 为 0 时不过期
+	defaultTTL time.Duration
 }
 
-func NewRedisCli(config *Config, prefix string) (RedisCli,error) {
+// ViewOption NewRedisCli 的可选配置
+type ViewOption func(r *redisView)
+
+// WithDefaultTTL 设置默认过期时间, Set/SetNX/SetXX/Expire 的 duration 为空或为 0 时使用.
+// 设置默认过期时间后需要写入不过期的 key 时使用 SetNoTTL/SetNXNoTTL/SetXXNoTTL, 移除过期时间使用 Persist
+func WithDefaultTTL(ttl time.Duration) ViewOption {
+	return func(r *redisView) {
+		r.defaultTTL = ttl
+	}
+}
+
+func NewRedisCli(config *Config, prefix string, opts ...ViewOption) (RedisCli,error) {
 	cmd, err := NewRedisCmd(config)
 	if err != nil {
 		return nil, err
@@ -28,6 +44,10 @@ func NewRedisCli(config *Config, prefix string) (RedisCli,error) {
 	view := &redisView{
 		cmd: cmd,
 		prefix: strings.Join([]string{config.KeyPrefix, prefix}, RedisKeySep),
+		cluster: config.UseCluster,
+	}
+	for _, opt := range opts {
+		opt(view)
 	}
 	return view, nil
 }
@@ -40,20 +60,57 @@ func (r *redisView) NativeCmd() RedisCmd {
 }
 
 func (r *redisView) SetNX(key string, value []byte, duration string) (bool, error) {
-	if duration != "" {
-		timeout, err := time.ParseDuration(duration)
-		if nil != err {
-			return false, err
-		}
-		return r.cmd.SetNX(r.expandKey(key), value, timeout).Result()
+	timeout, err := r.parseTTL(duration)
+	if nil != err {
+		return false, err
+	}
+	return r.SetNXDuration(key, value, timeout)
+}
+
+func (r *redisView) SetNXDuration(key string, value []byte, ttl time.Duration) (bool, error) {
+	timeout, err := r.ttlOrDefault(ttl)
+	if nil != err {
+		return false, err
+	}
+	return r.setNX(key, value, timeout)
+}
+
+// SetNXNoTTL 写入不过期的 key, 不使用默认过期时间
+func (r *redisView) SetNXNoTTL(key string, value []byte) (bool, error) {
+	return r.setNX(key, value, 0)
+}
+
+func (r *redisView) setNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	result, err := r.cmd.SetNX(r.expandKey(key), value, ttl).Result()
+	if nil != err {
+		return false, wrapError("setnx", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+//parseTTL 解析过期时间, 为空时使用默认过期时间
+func (r *redisView) parseTTL(duration string) (time.Duration, error) {
+	if duration == "" {
+		return r.defaultTTL, nil
+	}
+	return time.ParseDuration(duration)
+}
+
+//ttlOrDefault ttl 为 0 时使用默认过期时间, 为负数时返回错误
+func (r *redisView) ttlOrDefault(ttl time.Duration) (time.Duration, error) {
+	if ttl < 0 {
+		return 0, ErrorDurationNegative
+	}
+	if ttl == 0 {
+		return r.defaultTTL, nil
 	}
-	return r.cmd.SetNX(r.expandKey(key), value, 0).Result()
+	return ttl, nil
 }
 
 func (r *redisView) Scan(cursor uint64, match string, count int64) ([]string, error) {
 	result, _, err := r.cmd.Scan(cursor, r.expandKey(match), count).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("scan", r.expandKey(match), err)
 	}
 	return result, err
 }
@@ -61,20 +118,30 @@ func (r *redisView) Scan(cursor uint64, match string, count int64) ([]string, er
 func (r *redisView) Get(key string) ([]byte, error) {
 	result, err := r.cmd.Get(r.expandKey(key)).Result()
 	if nil != err {
-		return nil, errors.New("get value with key " + r.expandKey(key) + ", error: "+err.Error())
+		return nil, wrapError("get", r.expandKey(key), err)
 	}
 	return []byte(result), nil
 }
 
 func (r *redisView) Set(key string, value []byte, duration string) error {
-	if duration != "" {
-		timeout, err := time.ParseDuration(duration)
-		if nil != err {
-			return err
-		}
-		return r.cmd.Set(r.expandKey(key), value, timeout).Err()
+	timeout, err := r.parseTTL(duration)
+	if nil != err {
+		return err
+	}
+	return r.SetDuration(key, value, timeout)
+}
+
+func (r *redisView) SetDuration(key string, value []byte, ttl time.Duration) error {
+	timeout, err := r.ttlOrDefault(ttl)
+	if nil != err {
+		return err
 	}
-	return r.cmd.Set(r.expandKey(key), value, 0).Err()
+	return wrapError("set", r.expandKey(key), r.cmd.Set(r.expandKey(key), value, timeout).Err())
+}
+
+// SetNoTTL 写入不过期的 key, 不使用默认过期时间
+func (r *redisView) SetNoTTL(key string, value []byte) error {
+	return wrapError("set", r.expandKey(key), r.cmd.Set(r.expandKey(key), value, 0).Err())
 }
 
 func (r *redisView) Del(keys ...string) (int64, error) {
@@ -82,16 +149,30 @@ func (r *redisView) Del(keys ...string) (int64, error) {
 	for _, key := range keys {
 		all = append(all, r.expandKey(key))
 	}
-	return r.cmd.Del(all...).Result()
+	result, err := r.cmd.Del(all...).Result()
+	if nil != err {
+		return 0, wrapError("del", strings.Join(all, " "), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) Expire(key string, duration string) error {
-	timeout, err := time.ParseDuration(duration)
+	timeout, err := r.parseTTL(duration)
 	if nil != err {
 		return err
 	}
+	return r.ExpireDuration(key, timeout)
+}
 
-	return wrapResult(func() (interface{}, error) {
-		return r.cmd.Expire(r.expandKey(key), timeout).Result()
-	})
+func (r *redisView) ExpireDuration(key string, ttl time.Duration) error {
+	timeout, err := r.ttlOrDefault(ttl)
+	if nil != err {
+		return err
+	}
+	if timeout == 0 {
+		return ErrorDurationEmpty
+	}
+	return wrapError("pexpire", r.expandKey(key), wrapResult(func() (interface{}, error) {
+		return r.cmd.PExpire(r.expandKey(key), timeout).Result()
+	}))
 }
@@ -0,0 +1,100 @@
+package redisplus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultTTL(t *testing.T) {
+	view := &redisView{defaultTTL: time.Hour}
+	cases := []struct {
+		duration string
+		parsed   time.Duration
+		applied  time.Duration
+	}{
+		{"", time.Hour, time.Hour},
+		{"0s", 0, time.Hour},
+		{"1m", time.Minute, time.Minute},
+	}
+	for _, c := range cases {
+		parsed, err := view.parseTTL(c.duration)
+		if err != nil || parsed != c.parsed {
+			t.Fatalf("parseTTL(%q): got %v %v, want %v", c.duration, parsed, err, c.parsed)
+		}
+		if applied, err := view.ttlOrDefault(parsed); err != nil || applied != c.applied {
+			t.Fatalf("ttlOrDefault(%q): got %v %v, want %v", c.duration, applied, err, c.applied)
+		}
+	}
+	for _, ttl := range []time.Duration{-time.Nanosecond, -time.Second} {
+		if _, err := view.ttlOrDefault(ttl); err != ErrorDurationNegative {
+			t.Fatalf("ttlOrDefault(%v): got %v", ttl, err)
+		}
+	}
+	if _, err := view.parseTTL("1x"); err == nil {
+		t.Fatal("invalid duration")
+	}
+	if ttl, err := (&redisView{}).ttlOrDefault(0); err != nil || ttl != 0 {
+		t.Fatal(ttl, err)
+	}
+}
+
+func TestDefaultTTLApplied(t *testing.T) {
+	s, _ := newTestView(t)
+	view, err := NewRedisCli(&Config{Addrs: []string{s.Addr()}, KeyPrefix: "TEST"}, "dev", WithDefaultTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	view.Set("a", []byte("1"), "")
+	view.SetDuration("b", []byte("1"), 0)
+	view.SetDuration("c", []byte("1"), time.Minute)
+	view.SetNoTTL("d", []byte("1"))
+	view.SetNXNoTTL("e", []byte("1"))
+	view.SetXXNoTTL("c", []byte("1"))
+	for key, want := range map[string]time.Duration{"a": time.Hour, "b": time.Hour, "c": 0, "d": 0, "e": 0} {
+		if ttl := s.TTL("TEST:dev:" + key); ttl != want {
+			t.Fatalf("%s: ttl %v, want %v", key, ttl, want)
+		}
+	}
+	if err := view.ExpireDuration("a", 0); err != nil || s.TTL("TEST:dev:a") != time.Hour {
+		t.Fatal(err)
+	}
+	if value, err := view.GetExPersist("a"); err != nil || string(value) != "1" || s.TTL("TEST:dev:a") != 0 {
+		t.Fatal("GetExPersist did not persist the key", value, err)
+	}
+
+	//负数过期时间返回错误, 不写入也不修改过期时间
+	if err := view.SetDuration("f", []byte("1"), -time.Second); err != ErrorDurationNegative || s.Exists("TEST:dev:f") {
+		t.Fatal(err)
+	}
+	if _, err := view.SetNXDuration("f", []byte("1"), -time.Nanosecond); err != ErrorDurationNegative {
+		t.Fatal(err)
+	}
+	if _, err := view.SetXXDuration("b", []byte("2"), -time.Second); err != ErrorDurationNegative {
+		t.Fatal(err)
+	}
+	if err := view.Set("f", []byte("1"), "-1s"); err != ErrorDurationNegative {
+		t.Fatal(err)
+	}
+	if err := view.ExpireDuration("b", -time.Second); err != ErrorDurationNegative || s.TTL("TEST:dev:b") != time.Hour {
+		t.Fatal(err)
+	}
+	if _, err := view.GetExDuration("b", -time.Second); err != ErrorDurationNegative || s.TTL("TEST:dev:b") != time.Hour {
+		t.Fatal(err)
+	}
+
+	//通知内部写入的 key 按自身的延迟过期, 不受默认过期时间影响
+	n, err := NewNotification("order", view, WithPolicies(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	if err := n.PutNotification(entity); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL("TEST:dev:order:" + entity.notifyKey()); ttl != time.Minute {
+		t.Fatal("notify key ttl", ttl)
+	}
+	if ttl := s.TTL("TEST:dev:order:" + entity.valueKey()); ttl != time.Minute+defaultValueHolding {
+		t.Fatal("value key ttl", ttl)
+	}
+}
@@ -10,6 +10,8 @@ var ErrRedisAddrsEmpty = errors.New("addrs is empty")
 
 type RedisCmd interface {
 	redis.Cmdable
+	//Process 执行 redis.v5 未提供的命令
+	Process(cmd redis.Cmder) error
 }
 
 func NewRedisCmd(c *Config) (RedisCmd, error) {
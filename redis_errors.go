@@ -0,0 +1,41 @@
+package redisplus
+
+import (
+	"errors"
+	"gopkg.in/redis.v5"
+)
+
+// ErrNotFound key, field 或 member 不存在, 使用 errors.Is 判断
+var ErrNotFound = errors.New("not found")
+
+// CommandError 执行 redis 命令的错误, 包含命令与完整的 key
+type CommandError struct {
+	Command string
+	Key     string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	return e.Command + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Is 兼容使用 errors.Is(err, redis.Nil) 判断不存在的调用方
+func (e *CommandError) Is(target error) bool {
+	return target == redis.Nil && e.Err == ErrNotFound
+}
+
+//wrapError 为错误附加命令与 key, redis.Nil 转换为 ErrNotFound.
+//ErrorResultNotOK 与 ErrorResultNotTrue 原样返回, 兼容使用 == 判断的调用方
+func wrapError(command, key string, err error) error {
+	if nil == err || err == ErrorResultNotOK || err == ErrorResultNotTrue {
+		return err
+	}
+	if err == redis.Nil {
+		err = ErrNotFound
+	}
+	return &CommandError{Command: command, Key: key, Err: err}
+}
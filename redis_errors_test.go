@@ -0,0 +1,60 @@
+package redisplus
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+func TestNotFoundErrors(t *testing.T) {
+	_, view := newTestView(t)
+	view.LAppend("l", []byte("a"))
+	view.HSet("h", "a", []byte("1"))
+
+	cases := []struct {
+		name    string
+		call    func() error
+		command string
+		key     string
+	}{
+		{"get", func() error { _, err := view.Get("none"); return err }, "get", "TEST:dev:none"},
+		{"hget", func() error { _, err := view.HGet("h", "none"); return err }, "hget", "TEST:dev:h"},
+		{"lindex", func() error { _, err := view.LIndex("l", 5); return err }, "lindex", "TEST:dev:l"},
+	}
+	for _, c := range cases {
+		err := c.call()
+		if !errors.Is(err, ErrNotFound) || !errors.Is(err, redis.Nil) {
+			t.Fatalf("%s: %v is not ErrNotFound", c.name, err)
+		}
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Command != c.command || cmdErr.Key != c.key {
+			t.Fatalf("%s: got %#v, want command %s key %s", c.name, cmdErr, c.command, c.key)
+		}
+	}
+	if err := wrapError("get", "k", nil); err != nil {
+		t.Fatal(err)
+	}
+	//结果不符合预期的错误不包装, 调用方可以直接使用 == 判断
+	if err := view.ExpireDuration("none", time.Second); err != ErrorResultNotTrue {
+		t.Fatal(err)
+	}
+	if err := view.HSetNX("h", "a", []byte("2")); err != ErrorResultNotTrue {
+		t.Fatal(err)
+	}
+}
+
+func TestHMGetMissing(t *testing.T) {
+	_, view := newTestView(t)
+	view.HSet("h", "a", []byte("1"))
+	values, err := view.HMGet("h", "none", "a")
+	if err != nil || !reflect.DeepEqual(values, [][]byte{nil, []byte("1")}) {
+		t.Fatal(values, err)
+	}
+	values, err = view.HMGet("missing", "a")
+	if err != nil || !reflect.DeepEqual(values, [][]byte{nil}) {
+		t.Fatal(values, err)
+	}
+}
@@ -13,7 +13,7 @@ type Location struct {
 func (r *redisView) GeoAdd(key string, geoLocation ...*redis.GeoLocation) (int64, error) {
 	result, err := r.cmd.GeoAdd(r.expandKey(key), geoLocation...).Result()
 	if err != nil {
-		return 0, err
+		return 0, wrapError("geoadd", r.expandKey(key), err)
 	}
 	return result, nil
 }
@@ -21,7 +21,7 @@ func (r *redisView) GeoAdd(key string, geoLocation ...*redis.GeoLocation) (int64
 func (r *redisView) GeoRadius(key string, longitude, latitude float64, query *redis.GeoRadiusQuery) ([]redis.GeoLocation, error) {
 	result, err := r.cmd.GeoRadius(r.expandKey(key), longitude, latitude, query).Result()
 	if err != nil {
-		return nil, err
+		return nil, wrapError("georadius", r.expandKey(key), err)
 	}
 	return result, nil
 }
@@ -29,7 +29,7 @@ func (r *redisView) GeoRadius(key string, longitude, latitude float64, query *re
 func (r *redisView) GeoRadiusByMember(key, member string, query *redis.GeoRadiusQuery) ([]redis.GeoLocation, error) {
 	result, err := r.cmd.GeoRadiusByMember(r.expandKey(key), member, query).Result()
 	if err != nil {
-		return nil, err
+		return nil, wrapError("georadiusbymember", r.expandKey(key), err)
 	}
 	return result, nil
 }
@@ -37,7 +37,7 @@ func (r *redisView) GeoRadiusByMember(key, member string, query *redis.GeoRadius
 func (r *redisView) GeoDist(key string, member1, member2, unit string) (float64, error) {
 	result, err := r.cmd.GeoDist(r.expandKey(key), member1, member2, unit).Result()
 	if err != nil {
-		return 0, err
+		return 0, wrapError("geodist", r.expandKey(key), err)
 	}
 	return result, nil
 }
@@ -45,7 +45,7 @@ func (r *redisView) GeoDist(key string, member1, member2, unit string) (float64,
 func (r *redisView) GeoHash(key string, members ...string) ([]string, error) {
 	result, err := r.cmd.GeoHash(r.expandKey(key), members...).Result()
 	if err != nil {
-		return nil, err
+		return nil, wrapError("geohash", r.expandKey(key), err)
 	}
 	return result, nil
 }
@@ -53,7 +53,7 @@ func (r *redisView) GeoHash(key string, members ...string) ([]string, error) {
 func (r *redisView) GeoPos(key string, members ...string) ([]*redis.GeoPos, error) {
 	result, err := r.cmd.GeoPos(r.expandKey(key), members...).Result()
 	if err != nil {
-		return nil, err
+		return nil, wrapError("geopos", r.expandKey(key), err)
 	}
 
 	return result, nil
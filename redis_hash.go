@@ -1,15 +1,17 @@
 package redisplus
 
+import "gopkg.in/redis.v5"
+
 func (r *redisView) HSetNX(key, field string, value []byte) error {
-	return wrapResult(func() (interface{}, error) {
+	return wrapError("hsetnx", r.expandKey(key), wrapResult(func() (interface{}, error) {
 		return r.cmd.HSetNX(r.expandKey(key), field, value).Result()
-	})
+	}))
 }
 
 func (r *redisView) HSet(key, field string, value []byte) error {
-	return wrapResult(func() (interface{}, error) {
+	return wrapError("hset", r.expandKey(key), wrapResult(func() (interface{}, error) {
 		return r.cmd.HSet(r.expandKey(key), field, value).Result()
-	})
+	}))
 }
 
 func (r *redisView) HMSet(key string, Values map[string][]byte) error {
@@ -20,24 +22,34 @@ func (r *redisView) HMSet(key string, Values map[string][]byte) error {
 	for s, bytes := range Values {
 		in[s] = string(bytes)
 	}
-	return wrapResult(func() (interface{}, error) {
+	return wrapError("hmset", r.expandKey(key), wrapResult(func() (interface{}, error) {
 		return r.cmd.HMSet(r.expandKey(key), in).Result()
-	})
+	}))
 }
 
+// HGet field 不存在时返回 nil 与 ErrNotFound
 func (r *redisView) HGet(key, field string) ([]byte, error) {
 	result, err := r.cmd.HGet(r.expandKey(key), field).Result()
-	return []byte(result), err
+	if nil != err {
+		return nil, wrapError("hget", r.expandKey(key), err)
+	}
+	return []byte(result), nil
 }
 
+// HMGet 不存在的 field 对应的结果为 nil
 func (r *redisView) HMGet(key string, fields ...string) ([][]byte, error) {
 	result, err := r.cmd.HMGet(r.expandKey(key), fields...).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("hmget", r.expandKey(key), err)
 	}
-	var out [][]byte
-	for _, i2 := range result {
-		out = append(out, i2.([]byte))
+	out := make([][]byte, len(result))
+	for i, i2 := range result {
+		switch v := i2.(type) {
+		case string:
+			out[i] = []byte(v)
+		case []byte:
+			out[i] = v
+		}
 	}
 	return out, nil
 }
@@ -45,7 +57,7 @@ func (r *redisView) HMGet(key string, fields ...string) ([][]byte, error) {
 func (r *redisView) HGetAll(key string) (map[string][]byte, error) {
 	result, err := r.cmd.HGetAll(r.expandKey(key)).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("hgetall", r.expandKey(key), err)
 	}
 	out := make(map[string][]byte)
 	for s, s2 := range result {
@@ -55,23 +67,110 @@ func (r *redisView) HGetAll(key string) (map[string][]byte, error) {
 }
 
 func (r *redisView) HDel(key string, fields ...string) (int64, error) {
-	return r.cmd.HDel(r.expandKey(key), fields...).Result()
+	result, err := r.cmd.HDel(r.expandKey(key), fields...).Result()
+	if nil != err {
+		return 0, wrapError("hdel", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) HLen(key string) (int64, error) {
-	return r.cmd.HLen(r.expandKey(key)).Result()
+	result, err := r.cmd.HLen(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("hlen", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) HKeys(key string) ([]string, error) {
-	return r.cmd.HKeys(r.expandKey(key)).Result()
+	result, err := r.cmd.HKeys(r.expandKey(key)).Result()
+	if nil != err {
+		return nil, wrapError("hkeys", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) HValues(key string) ([][]byte, error) {
-	return wrapSliceStringToSliceBytes(func() ([]string, error) {
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
 		return r.cmd.HVals(r.expandKey(key)).Result()
 	})
+	if nil != err {
+		return nil, wrapError("hvals", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) HExists(key, field string) (bool, error) {
-	return r.cmd.HExists(r.expandKey(key), field).Result()
+	result, err := r.cmd.HExists(r.expandKey(key), field).Result()
+	if nil != err {
+		return false, wrapError("hexists", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) HIncrBy(key, field string, incr int64) (int64, error) {
+	result, err := r.cmd.HIncrBy(r.expandKey(key), field, incr).Result()
+	if nil != err {
+		return 0, wrapError("hincrby", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) HIncrByFloat(key, field string, incr float64) (float64, error) {
+	result, err := r.cmd.HIncrByFloat(r.expandKey(key), field, incr).Result()
+	if nil != err {
+		return 0, wrapError("hincrbyfloat", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// HStrLen field 不存在时返回 0, 需要 redis 3.2
+func (r *redisView) HStrLen(key, field string) (int64, error) {
+	cmd := redis.NewIntCmd("hstrlen", r.expandKey(key), field)
+	if err := r.cmd.Process(cmd); err != nil {
+		return 0, wrapError("hstrlen", r.expandKey(key), err)
+	}
+	result, err := cmd.Result()
+	if nil != err {
+		return 0, wrapError("hstrlen", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// HRandField 随机返回 count 个 field, count 为负数时允许重复, withValues 为 false 时 Value 为 nil, 需要 redis 6.2
+func (r *redisView) HRandField(key string, count int64, withValues bool) ([]*HashField, error) {
+	args := []interface{}{"hrandfield", r.expandKey(key), count}
+	if withValues {
+		args = append(args, "withvalues")
+	}
+	cmd := redis.NewStringSliceCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("hrandfield", r.expandKey(key), err)
+	}
+	result := cmd.Val()
+	if !withValues {
+		out := make([]*HashField, 0, len(result))
+		for _, field := range result {
+			out = append(out, &HashField{Field: field})
+		}
+		return out, nil
+	}
+	out := make([]*HashField, 0, len(result)/2)
+	for i := 0; i+1 < len(result); i += 2 {
+		out = append(out, &HashField{Field: result[i], Value: []byte(result[i+1])})
+	}
+	return out, nil
+}
+
+// HScan match 匹配 field, 返回的 cursor 为 0 时遍历结束
+func (r *redisView) HScan(key string, cursor uint64, match string, count int64) (map[string][]byte, uint64, error) {
+	result, next, err := r.cmd.HScan(r.expandKey(key), cursor, match, count).Result()
+	if nil != err {
+		return nil, 0, wrapError("hscan", r.expandKey(key), err)
+	}
+	out := make(map[string][]byte, len(result)/2)
+	for i := 0; i+1 < len(result); i += 2 {
+		out[result[i]] = []byte(result[i+1])
+	}
+	return out, next, nil
 }
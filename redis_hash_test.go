@@ -0,0 +1,123 @@
+package redisplus
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHashCommands(t *testing.T) {
+	_, view := newTestView(t)
+	if n, err := view.HIncrBy("counter", "u1", 2); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if f, err := view.HIncrByFloat("counter", "f", 1.5); err != nil || f != 1.5 {
+		t.Fatal(f, err)
+	}
+	if n, err := view.HStrLen("counter", "f"); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	fields, err := view.HRandField("counter", 2, true)
+	if err != nil || len(fields) != 2 || fields[0].Value == nil {
+		t.Fatal(fields, err)
+	}
+	values, cursor, err := view.HScan("counter", 0, "u*", 10)
+	if err != nil || cursor != 0 || !reflect.DeepEqual(values, map[string][]byte{"u1": []byte("2")}) {
+		t.Fatal(values, cursor, err)
+	}
+	if _, err := view.HGet("counter", "none"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+}
+
+func TestFieldTTLHash(t *testing.T) {
+	s, view := newTestView(t)
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	h := NewFieldTTLHash(view, "session")
+	h.clock = clock
+
+	if err := h.Set("a", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	h.Set("b", []byte("2"), 2*time.Minute)
+	h.Set("c", []byte("3"), 0)
+
+	keys := s.Keys()
+	sort.Strings(keys)
+	if want := []string{"TEST:dev:session", "{TEST:dev:session}:FIELD_DEADLINE"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("touched %v, want %v", keys, want)
+	}
+	if KeySlot(keys[0]) != KeySlot(keys[1]) {
+		t.Fatal("companion zset is not in the same slot")
+	}
+	if ttl, err := h.TTL("a"); err != nil || ttl != time.Minute {
+		t.Fatal(ttl, err)
+	}
+	if _, err := h.TTL("c"); !errors.Is(err, ErrKeyNoExpire) {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if _, err := h.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if s.HGet("TEST:dev:session", "a") != "" {
+		t.Fatal("expired field was not removed on read")
+	}
+	if value, err := h.Get("b"); err != nil || string(value) != "2" {
+		t.Fatal(value, err)
+	}
+	if ok, err := h.Expire("c", time.Second); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if ok, _ := h.Expire("none", time.Second); ok {
+		t.Fatal("expire on missing field")
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if n, err := h.Purge(); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	all, err := h.GetAll()
+	if err != nil || len(all) != 0 {
+		t.Fatal(all, err)
+	}
+
+	h.Set("e", []byte("5"), time.Second)
+	clock.now = clock.now.Add(time.Second)
+	if ok, err := h.Expire("e", time.Minute); err != nil || ok {
+		t.Fatal("expire revived an expired field", ok, err)
+	}
+	if len(s.Keys()) != 0 {
+		t.Fatal("expired field was not removed on expire", s.Keys())
+	}
+
+	h.Set("d", []byte("4"), time.Second)
+	if ok, err := h.Persist("d"); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if n, err := h.Del("d"); err != nil || n != 1 || len(s.Keys()) != 0 {
+		t.Fatal(n, err, s.Keys())
+	}
+}
+
+func TestFieldTTLHashPurgeEvery(t *testing.T) {
+	s, view := newTestView(t)
+	h := NewFieldTTLHash(view, "session")
+	h.Set("a", []byte("1"), 10*time.Millisecond)
+
+	stop, err := h.PurgeEvery(20*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	deadline := time.Now().Add(time.Second)
+	for s.Exists("TEST:dev:session") {
+		if time.Now().After(deadline) {
+			t.Fatal("expired field was not purged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,244 @@
+// per-field expiration of hashes, emulated with a companion zset of deadlines
+
+package redisplus
+
+import (
+	"errors"
+	"gopkg.in/redis.v5"
+	"time"
+)
+
+// FieldDeadlineSuffix 保存 field 过期时间的 zset 后缀, score 为过期时间(ms)
+const FieldDeadlineSuffix = "FIELD_DEADLINE"
+
+// defaultPurgeBatch 每次清理的 field 数量
+const defaultPurgeBatch = 100
+
+var errPurgeInterval = errors.New("purge interval must be positive")
+
+//setFieldScript 写入 field 并更新过期时间, ttl 为 0 时移除过期时间
+//KEYS[1] hash KEYS[2] 过期时间 zset
+//ARGV[1] field ARGV[2] value ARGV[3] 过期时间(ms), 0 表示不过期
+var setFieldScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if ARGV[3] == '0' then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+else
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+//getFieldScript 读取 field, 已过期时删除并返回 nil
+//KEYS[1] hash KEYS[2] 过期时间 zset
+//ARGV[1] field ARGV[2] 当前时间(ms)
+var getFieldScript = redis.NewScript(`
+local deadline = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if deadline and tonumber(deadline) <= tonumber(ARGV[2]) then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	return false
+end
+return redis.call('HGET', KEYS[1], ARGV[1])
+`)
+
+//expireFieldScript field 存在且未过期时设置过期时间, 已过期时删除
+//KEYS[1] hash KEYS[2] 过期时间 zset
+//ARGV[1] field ARGV[2] 过期时间(ms) ARGV[3] 当前时间(ms)
+var expireFieldScript = redis.NewScript(`
+local deadline = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if deadline and tonumber(deadline) <= tonumber(ARGV[3]) then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	return 0
+end
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+//delFieldScript 删除 field 与过期时间
+//KEYS[1] hash KEYS[2] 过期时间 zset
+//ARGV field 列表
+var delFieldScript = redis.NewScript(`
+redis.call('ZREM', KEYS[2], unpack(ARGV))
+return redis.call('HDEL', KEYS[1], unpack(ARGV))
+`)
+
+//purgeFieldScript 删除已过期的 field
+//KEYS[1] hash KEYS[2] 过期时间 zset
+//ARGV[1] 当前时间(ms) ARGV[2] 单次数量
+var purgeFieldScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #expired == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[1], unpack(expired))
+redis.call('ZREM', KEYS[2], unpack(expired))
+return #expired
+`)
+
+// FieldTTLHash 支持 field 级过期时间的 hash, 适用于不支持 HEXPIRE 的 redis.
+// 过期时间保存在同一个 slot 的 zset 中, 读取时惰性删除, 也可以通过 PurgeEvery 定期清理
+type FieldTTLHash struct {
+	cache     RedisCli
+	key       string //完整的 hash key
+	deadlines string //完整的过期时间 zset key
+	clock     Clock
+}
+
+// NewFieldTTLHash 创建 field 级过期的 hash, key 不包含前缀
+func NewFieldTTLHash(cache RedisCli, key string) *FieldTTLHash {
+	full := cache.KeyPrefix() + RedisKeySep + key
+	return &FieldTTLHash{
+		cache:     cache,
+		key:       full,
+		deadlines: companionKey(full, FieldDeadlineSuffix),
+		clock:     systemClock{},
+	}
+}
+
+func (h *FieldTTLHash) keys() []string {
+	return []string{h.key, h.deadlines}
+}
+
+// Set 写入 field, ttl 为 0 时不过期
+func (h *FieldTTLHash) Set(field string, value []byte, ttl time.Duration) error {
+	var deadline int64
+	if ttl > 0 {
+		deadline = toMillis(h.clock.Now().Add(ttl))
+	}
+	_, err := setFieldScript.Run(h.cache.NativeCmd(), h.keys(), field, value, deadline).Result()
+	return wrapError("hset", h.key, err)
+}
+
+// Get field 不存在或已过期时返回 ErrNotFound
+func (h *FieldTTLHash) Get(field string) ([]byte, error) {
+	ret, err := getFieldScript.Run(h.cache.NativeCmd(), h.keys(), field, toMillis(h.clock.Now())).Result()
+	if nil != err {
+		return nil, wrapError("hget", h.key, err)
+	}
+	value, _ := ret.(string)
+	return []byte(value), nil
+}
+
+// GetAll 清理已过期的 field 后返回全部 field
+func (h *FieldTTLHash) GetAll() (map[string][]byte, error) {
+	if _, err := h.Purge(); nil != err {
+		return nil, err
+	}
+	result, err := h.cache.NativeCmd().HGetAll(h.key).Result()
+	if nil != err {
+		return nil, wrapError("hgetall", h.key, err)
+	}
+	out := make(map[string][]byte, len(result))
+	for field, value := range result {
+		out[field] = []byte(value)
+	}
+	return out, nil
+}
+
+// Expire 为已存在的 field 设置过期时间, field 不存在时返回 false
+func (h *FieldTTLHash) Expire(field string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, ErrorDurationEmpty
+	}
+	now := h.clock.Now()
+	ret, err := expireFieldScript.Run(h.cache.NativeCmd(), h.keys(), field, toMillis(now.Add(ttl)), toMillis(now)).Result()
+	if nil != err {
+		return false, wrapError("hexpire", h.key, err)
+	}
+	return ret == int64(1), nil
+}
+
+// Persist 移除 field 的过期时间
+func (h *FieldTTLHash) Persist(field string) (bool, error) {
+	count, err := h.cache.NativeCmd().ZRem(h.deadlines, field).Result()
+	if nil != err {
+		return false, wrapError("zrem", h.deadlines, err)
+	}
+	return count == 1, nil
+}
+
+// TTL field 不存在或已过期时返回 ErrKeyNotExist, 没有过期时间时返回 ErrKeyNoExpire
+func (h *FieldTTLHash) TTL(field string) (time.Duration, error) {
+	deadline, err := h.cache.NativeCmd().ZScore(h.deadlines, field).Result()
+	if err == redis.Nil {
+		exists, err := h.cache.NativeCmd().HExists(h.key, field).Result()
+		if nil != err {
+			return 0, wrapError("hexists", h.key, err)
+		}
+		if exists {
+			return 0, wrapError("httl", h.key, ErrKeyNoExpire)
+		}
+		return 0, wrapError("httl", h.key, ErrKeyNotExist)
+	}
+	if nil != err {
+		return 0, wrapError("zscore", h.deadlines, err)
+	}
+	ttl := fromMillis(deadline).Sub(h.clock.Now())
+	if ttl <= 0 {
+		return 0, wrapError("httl", h.key, ErrKeyNotExist)
+	}
+	return ttl, nil
+}
+
+// Del 删除 field 与过期时间, 返回删除的 field 数量
+func (h *FieldTTLHash) Del(fields ...string) (int64, error) {
+	if 0 == len(fields) {
+		return 0, nil
+	}
+	args := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		args = append(args, field)
+	}
+	ret, err := delFieldScript.Run(h.cache.NativeCmd(), h.keys(), args...).Result()
+	if nil != err {
+		return 0, wrapError("hdel", h.key, err)
+	}
+	count, _ := ret.(int64)
+	return count, nil
+}
+
+// Len 返回 field 数量, 包含已过期但尚未清理的 field
+func (h *FieldTTLHash) Len() (int64, error) {
+	result, err := h.cache.NativeCmd().HLen(h.key).Result()
+	if nil != err {
+		return 0, wrapError("hlen", h.key, err)
+	}
+	return result, nil
+}
+
+// Purge 删除已过期的 field, 返回删除的数量
+func (h *FieldTTLHash) Purge() (int64, error) {
+	var total int64
+	for {
+		ret, err := purgeFieldScript.Run(h.cache.NativeCmd(), h.keys(), toMillis(h.clock.Now()), defaultPurgeBatch).Result()
+		if nil != err {
+			return total, wrapError("hpurge", h.key, err)
+		}
+		count, _ := ret.(int64)
+		total += count
+		if count < defaultPurgeBatch {
+			break
+		}
+	}
+	return total, nil
+}
+
+// PurgeEvery 每隔 interval 清理一次已过期的 field, 返回停止清理的函数
+func (h *FieldTTLHash) PurgeEvery(interval time.Duration, logger Logger) (func(), error) {
+	if interval <= 0 {
+		return nil, errPurgeInterval
+	}
+	if nil == logger {
+		logger = nopLogger{}
+	}
+	return runEvery(interval, func() {
+		if _, err := h.Purge(); nil != err {
+			logger.Error("purge expired fields error", "key", h.key, "error", err.Error())
+		}
+	}), nil
+}
@@ -1,10 +1,19 @@
 package redisplus
 
 import (
+	"context"
 	"gopkg.in/redis.v5"
 	"strings"
+	"sync"
+	"time"
 )
 
+// blockingStep 阻塞命令单次等待的时间, 需要小于客户端的读超时
+const blockingStep = time.Second
+
+// blockingSeconds 阻塞命令的 timeout 参数, 使用整数秒兼容 redis 6.0 之前的版本
+const blockingSeconds = int64(blockingStep / time.Second)
+
 // expandKey is used to expand to the full prefix path with the prefix
 func (r *redisView) expandKey(suffix string) string {
 	return r.prefix + RedisKeySep + suffix
@@ -12,8 +21,55 @@ func (r *redisView) expandKey(suffix string) string {
 
 // truncateKey is used to remove the prefix of the prefix
 func (r *redisView) truncateKey(full string) string {
-	return strings.Join(strings.Split(full, RedisKeySep)[1:], RedisKeySep)
+	return strings.TrimPrefix(full, r.prefix+RedisKeySep)
+}
+//expandKeys 展开多个 key
+func (r *redisView) expandKeys(keys []string) []string {
+	all := make([]string, 0, len(keys))
+	for _, key := range keys {
+		all = append(all, r.expandKey(key))
+	}
+	return all
+}
+
+//blockingCall 循环执行单次阻塞 blockingStep 的命令, 直到有结果, 出错或 ctx 结束.
+//call 返回 redis.Nil 表示本次等待超时, ctx 结束最多延迟 blockingStep 生效
+func blockingCall(ctx context.Context, call func() error) error {
+	for {
+		if err := ctx.Err(); nil != err {
+			return err
+		}
+		if err := call(); err != redis.Nil {
+			return err
+		}
+	}
+}
+
+//runEvery 每隔 interval 在后台执行一次 fn, 返回的函数停止执行并等待 fn 返回, 可以重复调用
+func runEvery(interval time.Duration, fn func()) func() {
+	done := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
 }
+
 func wrapResult(call func() (interface{}, error)) error {
 	result, err := call()
 	if nil != err {
@@ -47,23 +103,23 @@ func toRangeZMembers(err error, members []string, zSlice []redis.Z) ([]*ZMember,
 	if nil != err {
 		return nil, err
 	}
-	var zMembers []*ZMember
-	if len(members) > 0 {
-		for _, m := range members {
-			member := ZMember{
-				Member: []byte(m),
-			}
-			zMembers = append(zMembers, &member)
-		}
+	zMembers := make([]*ZMember, 0, len(members)+len(zSlice))
+	for _, m := range members {
+		zMembers = append(zMembers, &ZMember{Member: []byte(m)})
 	}
-	if len(members) > 0 {
-		for _, m := range zSlice {
-			member := ZMember{
-				Score:  m.Score,
-				Member: m.Member.([]byte),
-			}
-			zMembers = append(zMembers, &member)
-		}
+	for _, m := range zSlice {
+		zMembers = append(zMembers, &ZMember{Score: m.Score, Member: memberBytes(m.Member)})
 	}
 	return zMembers, nil
 }
+
+//memberBytes 转换 redis.Z 中的 member, 读取结果时为 string
+func memberBytes(member interface{}) []byte {
+	switch v := member.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	}
+	return nil
+}
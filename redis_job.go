@@ -0,0 +1,677 @@
+// priority and delayed job queue on sorted sets
+
+package redisplus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"gopkg.in/redis.v5"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	JobDelayedSuffix = "JOB_DELAYED" //未到执行时间的任务, score 为执行时间(ms)
+	JobReadySuffix   = "JOB_READY"   //可以执行的任务, score 为优先级与执行时间的组合
+	JobActiveSuffix  = "JOB_ACTIVE"  //执行中的任务, score 为租约到期时间(ms)
+	JobDeadSuffix    = "JOB_DEAD"    //重试耗尽的任务, score 为失败时间(ms)
+	JobDataSuffix    = "JOB_DATA"    //任务内容, field 为任务 ID
+	JobLeaseSuffix   = "JOB_LEASE"   //执行中任务的租约 token, field 为任务 ID
+)
+
+// MaxJobPriority 任务的最大优先级, 优先级越大越先执行
+const MaxJobPriority = 100
+
+// jobPriorityWeight 每级优先级在 ready score 中的权重, 大于任意毫秒时间戳
+const jobPriorityWeight = 1e13
+
+// defaultJobBatch 每次认领时转移的到期任务数量
+const defaultJobBatch = 100
+
+var errJobPriority = errors.New("job priority must be between 0 and MaxJobPriority")
+var errJobHandlerNotNil = errors.New("job handler must be not null")
+var errJobNotClaimed = errors.New("job must be claimed before complete or fail")
+
+// DefaultJobRetryPolicy 任务默认的重试策略, 最多重试 5 次
+var DefaultJobRetryPolicy = ExponentialPolicy(time.Second, time.Minute*5, 5)
+
+//enqueueJobScript ID 不存在时写入任务
+//KEYS[1] 任务内容 KEYS[2] 延迟任务
+//ARGV[1] ID ARGV[2] 任务内容 ARGV[3] 执行时间(ms)
+var enqueueJobScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+//claimJobScript 处理租约过期的任务, 将到期任务按优先级转入 ready, 认领优先级最高的任务.
+//租约过期视为一次失败: 重试次数加一, 按重试延迟移入延迟任务, 重试耗尽时移入死信.
+//只处理参数中给出且租约仍已过期的任务, 其余过期任务在下次认领时处理.
+//rank 为字符串, 避免 cjson 按 14 位有效数字编码
+//KEYS[1] 延迟任务 KEYS[2] ready KEYS[3] 执行中 KEYS[4] 任务内容 KEYS[5] 死信 KEYS[6] 租约 token
+//ARGV[1] 当前时间(ms) ARGV[2] 租约到期时间(ms) ARGV[3] 单次数量 ARGV[4] 租约 token
+//ARGV[5] 最大重试次数 n, 之后每个租约过期的任务依次为 ID 与 n 个重试延迟(ms)
+var claimJobScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local retries = tonumber(ARGV[5])
+for i = 6, #ARGV, retries + 1 do
+	local id = ARGV[i]
+	local deadline = redis.call('ZSCORE', KEYS[3], id)
+	local data = false
+	if deadline and tonumber(deadline) <= now then
+		redis.call('ZREM', KEYS[3], id)
+		redis.call('HDEL', KEYS[6], id)
+		data = redis.call('HGET', KEYS[4], id)
+	end
+	if data then
+		local record = cjson.decode(data)
+		local attempt = tonumber(record.attempt) or 0
+		record.attempt = attempt + 1
+		record.error = 'lease expired'
+		if attempt >= retries then
+			redis.call('ZADD', KEYS[5], now, id)
+		else
+			local runAt = now + tonumber(ARGV[i + 1 + attempt])
+			record.rank = string.format('%.0f', tonumber(record.rank) - tonumber(record.run_at) + runAt)
+			record.run_at = runAt
+			redis.call('ZADD', KEYS[1], runAt, id)
+		end
+		redis.call('HSET', KEYS[4], id, cjson.encode(record))
+	end
+end
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[4], id)
+	if data then
+		redis.call('ZADD', KEYS[2], cjson.decode(data).rank, id)
+	end
+end
+local ready = redis.call('ZRANGE', KEYS[2], 0, 0)
+if #ready == 0 then
+	return false
+end
+redis.call('ZREM', KEYS[2], ready[1])
+redis.call('ZADD', KEYS[3], ARGV[2], ready[1])
+redis.call('HSET', KEYS[6], ready[1], ARGV[4])
+return redis.call('HGET', KEYS[4], ready[1])
+`)
+
+//completeJobScript 任务仍在执行中且租约 token 一致时删除
+//KEYS[1] 执行中 KEYS[2] 任务内容 KEYS[3] 租约 token
+//ARGV[1] ID ARGV[2] 租约 token
+var completeJobScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] or redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+//moveJobScript 任务仍在执行中且租约 token 一致时更新内容并移入目标 zset, 用于重试与进入死信
+//KEYS[1] 执行中 KEYS[2] 目标 KEYS[3] 任务内容 KEYS[4] 租约 token
+//ARGV[1] ID ARGV[2] 任务内容 ARGV[3] score ARGV[4] 租约 token
+var moveJobScript = redis.NewScript(`
+if redis.call('HGET', KEYS[4], ARGV[1]) ~= ARGV[4] or redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+//cancelJobScript 删除尚未执行的任务
+//KEYS[1] 延迟任务 KEYS[2] ready KEYS[3] 任务内容
+//ARGV[1] ID
+var cancelJobScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) + redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+//deleteDeadJobScript 删除死信任务, 只删除确实在死信中的任务内容
+//KEYS[1] 死信 KEYS[2] 任务内容
+//ARGV ID 列表
+var deleteDeadJobScript = redis.NewScript(`
+local count = 0
+for _, id in ipairs(ARGV) do
+	if redis.call('ZREM', KEYS[1], id) == 1 then
+		redis.call('HDEL', KEYS[2], id)
+		count = count + 1
+	end
+end
+return count
+`)
+
+//renewJobScript 延长租约 token 一致的执行中任务的租约
+//KEYS[1] 执行中 KEYS[2] 租约 token
+//ARGV[1] 租约到期时间(ms) ARGV[2] 之后依次为 ID 与租约 token
+var renewJobScript = redis.NewScript(`
+for i = 2, #ARGV, 2 do
+	if redis.call('HGET', KEYS[2], ARGV[i]) == ARGV[i + 1] then
+		redis.call('ZADD', KEYS[1], 'XX', ARGV[1], ARGV[i])
+	end
+end
+return 1
+`)
+
+// Job 队列中的任务
+type Job struct {
+	ID       string    //为空时 Enqueue 生成, 相同 ID 的任务在完成或删除之前只能写入一次
+	Payload  []byte    //任务内容
+	Priority int       //0 到 MaxJobPriority, 同时到期的任务优先级大的先执行
+	RunAt    time.Time //执行时间, 为空时立即执行
+	Attempt  int       //已失败的次数
+	Err      string    //最后一次失败的原因
+	Token    string    //Claim 返回的租约 token, Complete 与 Fail 时校验, 租约被其他执行器接管后失效
+}
+
+//jobRecord 任务在 redis 中的 JSON 格式, rank 为 ready score, 使用字符串避免 lua 转换精度
+type jobRecord struct {
+	ID       string `json:"id"`
+	Payload  []byte `json:"payload"`
+	Priority int    `json:"priority"`
+	RunAt    int64  `json:"run_at"`
+	Attempt  int    `json:"attempt"`
+	Err      string `json:"error,omitempty"`
+	Rank     string `json:"rank"`
+}
+
+func (j *Job) encode() (string, error) {
+	runAt := toMillis(j.RunAt)
+	rank := float64(MaxJobPriority-j.Priority)*jobPriorityWeight + float64(runAt)
+	bs, err := json.Marshal(&jobRecord{
+		ID:       j.ID,
+		Payload:  j.Payload,
+		Priority: j.Priority,
+		RunAt:    runAt,
+		Attempt:  j.Attempt,
+		Err:      j.Err,
+		Rank:     strconv.FormatFloat(rank, 'f', -1, 64),
+	})
+	return string(bs), err
+}
+
+func decodeJob(data string) (*Job, error) {
+	var record jobRecord
+	if err := json.Unmarshal([]byte(data), &record); nil != err {
+		return nil, err
+	}
+	return &Job{
+		ID:       record.ID,
+		Payload:  record.Payload,
+		Priority: record.Priority,
+		RunAt:    fromMillis(float64(record.RunAt)),
+		Attempt:  record.Attempt,
+		Err:      record.Err,
+	}, nil
+}
+
+// JobHandler 执行任务, 返回 nil 时任务完成, 返回错误时按重试策略重试, 重试耗尽后进入死信
+type JobHandler func(ctx context.Context, job *Job) error
+
+// JobQueueOption 创建任务队列的可选配置
+type JobQueueOption func(q *JobQueue) error
+
+// WithJobRetryPolicy 设置失败任务的重试策略, 默认 DefaultJobRetryPolicy
+func WithJobRetryPolicy(policy RetryPolicy) JobQueueOption {
+	return func(q *JobQueue) error {
+		if 0 == len(policy.delays) {
+			return errPoliciesEmpty
+		}
+		q.retry = policy
+		return nil
+	}
+}
+
+// WithJobLease 设置任务的执行租约, 租约过期的任务会被重新认领, 默认 30s
+func WithJobLease(lease time.Duration) JobQueueOption {
+	return func(q *JobQueue) error {
+		if lease < minLockTTL {
+			return errLockTTL
+		}
+		q.lease = lease
+		return nil
+	}
+}
+
+// WithJobLogger 设置日志, 默认不输出日志
+func WithJobLogger(logger Logger) JobQueueOption {
+	return func(q *JobQueue) error {
+		if nil == logger {
+			return errLoggerNotNil
+		}
+		q.logger = logger
+		return nil
+	}
+}
+
+// JobCounts 各状态的任务数量
+type JobCounts struct {
+	Delayed int64
+	Ready   int64
+	Active  int64
+	Dead    int64
+}
+
+// JobQueue 基于 zset 的延迟任务队列, 支持优先级, 失败重试与按 ID 去重.
+// 所有 key 使用 {name} 作为 hash tag, 集群模式下在同一个 slot
+type JobQueue struct {
+	cache  RedisCli
+	name   string
+	retry  RetryPolicy
+	lease  time.Duration
+	logger Logger
+	clock  Clock
+}
+
+// NewJobQueue 创建任务队列, name 不包含前缀
+func NewJobQueue(cache RedisCli, name string, opts ...JobQueueOption) (*JobQueue, error) {
+	q := &JobQueue{
+		cache:  cache,
+		name:   name,
+		retry:  DefaultJobRetryPolicy,
+		lease:  defaultLockTTL,
+		logger: nopLogger{},
+		clock:  systemClock{},
+	}
+	for _, opt := range opts {
+		if err := opt(q); nil != err {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+//key 不包含前缀的 key, 用于 RedisCli 的方法
+func (q *JobQueue) key(suffix string) string {
+	return companionKey(q.name, suffix)
+}
+
+//fullKey 完整的 key, 用于 lua 脚本
+func (q *JobQueue) fullKey(suffix string) string {
+	return q.cache.KeyPrefix() + RedisKeySep + q.key(suffix)
+}
+
+// Enqueue 写入任务, ID 已存在时返回 false
+func (q *JobQueue) Enqueue(job *Job) (bool, error) {
+	if job.Priority < 0 || job.Priority > MaxJobPriority {
+		return false, errJobPriority
+	}
+	if "" == job.ID {
+		job.ID = uuid.New().String()
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = q.clock.Now()
+	}
+	data, err := job.encode()
+	if nil != err {
+		return false, err
+	}
+	keys := []string{q.fullKey(JobDataSuffix), q.fullKey(JobDelayedSuffix)}
+	ret, err := enqueueJobScript.Run(q.cache.NativeCmd(), keys, job.ID, data, toMillis(job.RunAt)).Result()
+	if nil != err {
+		return false, wrapError("enqueue", q.fullKey(JobDataSuffix), err)
+	}
+	return ret == int64(1), nil
+}
+
+// Claim 认领一个到期的任务, 没有可执行的任务时返回 ErrNotFound.
+// 返回的任务带有租约 token, 需要在租约内调用 Complete 或 Fail, 否则视为失败, 按重试策略重试或进入死信
+func (q *JobQueue) Claim() (*Job, error) {
+	now := q.clock.Now()
+	token := uuid.New().String()
+	keys := []string{
+		q.fullKey(JobDelayedSuffix),
+		q.fullKey(JobReadySuffix),
+		q.fullKey(JobActiveSuffix),
+		q.fullKey(JobDataSuffix),
+		q.fullKey(JobDeadSuffix),
+		q.fullKey(JobLeaseSuffix),
+	}
+	args := []interface{}{toMillis(now), toMillis(now.Add(q.lease)), defaultJobBatch, token, len(q.retry.delays)}
+	//租约过期的任务按任务 ID 计算重试延迟, 同一队列的任务分散重试
+	expired, err := q.cache.NativeCmd().ZRangeByScore(q.fullKey(JobActiveSuffix), redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(toMillis(now), 10),
+		Count: defaultJobBatch,
+	}).Result()
+	if nil != err {
+		return nil, wrapError("zrangebyscore", q.fullKey(JobActiveSuffix), err)
+	}
+	for _, id := range expired {
+		args = append(args, id)
+		for attempt := range q.retry.delays {
+			args = append(args, int64(q.retry.delay(id, attempt, now)/time.Millisecond))
+		}
+	}
+	ret, err := claimJobScript.Run(q.cache.NativeCmd(), keys, args...).Result()
+	if nil != err {
+		return nil, wrapError("claim", q.fullKey(JobReadySuffix), err)
+	}
+	data, _ := ret.(string)
+	job, err := decodeJob(data)
+	if nil != err {
+		return nil, err
+	}
+	job.Token = token
+	return job, nil
+}
+
+// Complete 任务执行成功, 删除任务. 任务已不在执行中或租约已被其他执行器接管时返回 false
+func (q *JobQueue) Complete(job *Job) (bool, error) {
+	if "" == job.Token {
+		return false, errJobNotClaimed
+	}
+	keys := []string{q.fullKey(JobActiveSuffix), q.fullKey(JobDataSuffix), q.fullKey(JobLeaseSuffix)}
+	ret, err := completeJobScript.Run(q.cache.NativeCmd(), keys, job.ID, job.Token).Result()
+	if nil != err {
+		return false, wrapError("complete", q.fullKey(JobActiveSuffix), err)
+	}
+	return ret == int64(1), nil
+}
+
+// Fail 任务执行失败, 按重试策略延迟重试, 重试耗尽后进入死信.
+// 返回任务是否进入死信, 任务已不在执行中或租约已被其他执行器接管时不做任何修改
+func (q *JobQueue) Fail(job *Job, cause error) (bool, error) {
+	if "" == job.Token {
+		return false, errJobNotClaimed
+	}
+	now := q.clock.Now()
+	if nil != cause {
+		job.Err = cause.Error()
+	}
+	dead := job.Attempt >= len(q.retry.delays)
+	target, score := JobDeadSuffix, toMillis(now)
+	if !dead {
+		job.RunAt = now.Add(q.retry.delay(job.ID, job.Attempt, now))
+		target, score = JobDelayedSuffix, toMillis(job.RunAt)
+	}
+	job.Attempt++
+	data, err := job.encode()
+	if nil != err {
+		return false, err
+	}
+	keys := []string{q.fullKey(JobActiveSuffix), q.fullKey(target), q.fullKey(JobDataSuffix), q.fullKey(JobLeaseSuffix)}
+	ret, err := moveJobScript.Run(q.cache.NativeCmd(), keys, job.ID, data, score, job.Token).Result()
+	if nil != err {
+		return false, wrapError("fail", q.fullKey(JobActiveSuffix), err)
+	}
+	return dead && ret == int64(1), nil
+}
+
+// Cancel 删除尚未执行的任务, 任务不存在或正在执行时返回 false
+func (q *JobQueue) Cancel(id string) (bool, error) {
+	keys := []string{q.fullKey(JobDelayedSuffix), q.fullKey(JobReadySuffix), q.fullKey(JobDataSuffix)}
+	ret, err := cancelJobScript.Run(q.cache.NativeCmd(), keys, id).Result()
+	if nil != err {
+		return false, wrapError("cancel", q.fullKey(JobDataSuffix), err)
+	}
+	return ret == int64(1), nil
+}
+
+// Get 读取任务, 不存在时返回 ErrNotFound
+func (q *JobQueue) Get(id string) (*Job, error) {
+	data, err := q.cache.HGet(q.key(JobDataSuffix), id)
+	if nil != err {
+		return nil, err
+	}
+	return decodeJob(string(data))
+}
+
+// Scheduled 返回执行时间不晚于 until 的延迟任务 ID, 按执行时间排序
+func (q *JobQueue) Scheduled(until time.Time, count int64) ([]string, error) {
+	members, err := q.cache.ZRangeByScore(q.key(JobDelayedSuffix), ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(toMillis(until), 10),
+		Count: count,
+	}, false, false)
+	if nil != err {
+		return nil, err
+	}
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, string(member.Member))
+	}
+	return ids, nil
+}
+
+// Dead 返回进入死信的任务, 按失败时间排序
+func (q *JobQueue) Dead(start, stop int64) ([]*Job, error) {
+	members, err := q.cache.ZRange(q.key(JobDeadSuffix), start, stop, false, false)
+	if nil != err {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(members))
+	for _, member := range members {
+		job, err := q.Get(string(member.Member))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if nil != err {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// DeleteDead 删除死信任务, 删除后相同 ID 的任务可以重新写入. 不在死信中的 ID 不做修改
+func (q *JobQueue) DeleteDead(ids ...string) (int64, error) {
+	if 0 == len(ids) {
+		return 0, nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	keys := []string{q.fullKey(JobDeadSuffix), q.fullKey(JobDataSuffix)}
+	ret, err := deleteDeadJobScript.Run(q.cache.NativeCmd(), keys, args...).Result()
+	if nil != err {
+		return 0, wrapError("deletedead", q.fullKey(JobDeadSuffix), err)
+	}
+	count, _ := ret.(int64)
+	return count, nil
+}
+
+// Counts 返回各状态的任务数量
+func (q *JobQueue) Counts() (JobCounts, error) {
+	var counts JobCounts
+	for _, c := range []struct {
+		suffix string
+		count  *int64
+	}{
+		{JobDelayedSuffix, &counts.Delayed},
+		{JobReadySuffix, &counts.Ready},
+		{JobActiveSuffix, &counts.Active},
+		{JobDeadSuffix, &counts.Dead},
+	} {
+		count, err := q.cache.ZLen(q.key(c.suffix))
+		if nil != err {
+			return counts, err
+		}
+		*c.count = count
+	}
+	return counts, nil
+}
+
+//renew 延长执行中任务的租约, tokens 为任务 ID 到租约 token 的映射,
+//已不在执行中或已被其他执行器接管的任务不续期
+func (q *JobQueue) renew(tokens map[string]string) error {
+	if 0 == len(tokens) {
+		return nil
+	}
+	args := []interface{}{toMillis(q.clock.Now().Add(q.lease))}
+	for id, token := range tokens {
+		args = append(args, id, token)
+	}
+	keys := []string{q.fullKey(JobActiveSuffix), q.fullKey(JobLeaseSuffix)}
+	return wrapError("renew", q.fullKey(JobActiveSuffix), renewJobScript.Run(q.cache.NativeCmd(), keys, args...).Err())
+}
+
+// WorkOption 任务执行器的可选配置
+type WorkOption func(o *workOptions)
+
+type workOptions struct {
+	workers      int
+	pollInterval time.Duration
+}
+
+// WithJobWorkers 设置并发执行任务的 worker 数量, 默认 1
+func WithJobWorkers(workers int) WorkOption {
+	return func(o *workOptions) {
+		if workers > 0 {
+			o.workers = workers
+		}
+	}
+}
+
+// WithJobPollInterval 设置没有可执行任务时的轮询间隔, 默认 1s
+func WithJobPollInterval(interval time.Duration) WorkOption {
+	return func(o *workOptions) {
+		if interval > 0 {
+			o.pollInterval = interval
+		}
+	}
+}
+
+// JobWorker 任务执行器句柄
+type JobWorker interface {
+	// Stop 停止认领新任务, 等待执行中的任务结束
+	Stop()
+	// Wait 阻塞直到执行器完全停止
+	Wait()
+}
+
+type jobWorker struct {
+	q            *JobQueue
+	handler      JobHandler
+	ctx          context.Context
+	pollInterval time.Duration
+
+	lock sync.Mutex
+	held map[string]string //执行中任务的租约 token, 定期续租
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	workers  sync.WaitGroup
+}
+
+// Work 启动执行器, ctx 结束时执行器停止, 同时传递给 handler; Stop 不会取消 handler 的 ctx
+func (q *JobQueue) Work(ctx context.Context, handler JobHandler, opts ...WorkOption) (JobWorker, error) {
+	if nil == handler {
+		return nil, errJobHandlerNotNil
+	}
+	o := &workOptions{workers: defaultWorkers, pollInterval: defaultPollInterval}
+	for _, opt := range opts {
+		opt(o)
+	}
+	w := &jobWorker{
+		q:            q,
+		handler:      handler,
+		ctx:          ctx,
+		pollInterval: o.pollInterval,
+		held:         make(map[string]string),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for i := 0; i < o.workers; i++ {
+		w.workers.Add(1)
+		go w.work()
+	}
+	stopRenew := runEvery(q.lease/3, w.renew)
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+		case <-w.stop:
+		}
+	}()
+	go func() {
+		w.workers.Wait()
+		stopRenew()
+		close(w.done)
+	}()
+	return w, nil
+}
+
+func (w *jobWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	w.Wait()
+}
+
+func (w *jobWorker) Wait() {
+	<-w.done
+}
+
+func (w *jobWorker) work() {
+	defer w.workers.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+		job, err := w.q.Claim()
+		if nil != err {
+			if !errors.Is(err, ErrNotFound) {
+				w.q.logger.Error("claim job error", "queue", w.q.name, "error", err.Error())
+			}
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(w.pollInterval):
+			}
+			continue
+		}
+		w.handle(job)
+	}
+}
+
+func (w *jobWorker) handle(job *Job) {
+	w.lock.Lock()
+	w.held[job.ID] = job.Token
+	w.lock.Unlock()
+	defer func() {
+		w.lock.Lock()
+		delete(w.held, job.ID)
+		w.lock.Unlock()
+	}()
+
+	if cause := w.handler(w.ctx, job); nil != cause {
+		dead, err := w.q.Fail(job, cause)
+		if nil != err {
+			w.q.logger.Error("fail job error", "queue", w.q.name, "id", job.ID, "error", err.Error())
+		} else if dead {
+			w.q.logger.Warn("job exhausted retries", "queue", w.q.name, "id", job.ID, "error", cause.Error())
+		}
+		return
+	}
+	if _, err := w.q.Complete(job); nil != err {
+		w.q.logger.Error("complete job error", "queue", w.q.name, "id", job.ID, "error", err.Error())
+	}
+}
+
+func (w *jobWorker) renew() {
+	w.lock.Lock()
+	tokens := make(map[string]string, len(w.held))
+	for id, token := range w.held {
+		tokens[id] = token
+	}
+	w.lock.Unlock()
+	if err := w.q.renew(tokens); nil != err {
+		w.q.logger.Error("renew job lease error", "queue", w.q.name, "error", err.Error())
+	}
+}
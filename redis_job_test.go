@@ -0,0 +1,299 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestJobQueue(t *testing.T, opts ...JobQueueOption) (*JobQueue, *manualClock) {
+	_, view := newTestView(t)
+	q, err := NewJobQueue(view, "jobs", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	q.clock = clock
+	return q, clock
+}
+
+func TestJobQueueOrder(t *testing.T) {
+	q, clock := newTestJobQueue(t, WithJobLease(time.Hour))
+	now := clock.now
+	jobs := []*Job{
+		{ID: "late", Priority: MaxJobPriority, RunAt: now.Add(time.Minute)},
+		{ID: "low", Priority: 1, RunAt: now.Add(-2 * time.Second)},
+		{ID: "high", Priority: 10, RunAt: now},
+		{ID: "high-early", Priority: 10, RunAt: now.Add(-time.Second)},
+	}
+	for _, job := range jobs {
+		if ok, err := q.Enqueue(job); err != nil || !ok {
+			t.Fatal(job.ID, ok, err)
+		}
+	}
+	if ok, err := q.Enqueue(&Job{ID: "low", Priority: 50}); err != nil || ok {
+		t.Fatal("duplicate job enqueued", err)
+	}
+	if _, err := q.Enqueue(&Job{Priority: MaxJobPriority + 1}); err != errJobPriority {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"high-early", "high", "low"} {
+		job, err := q.Claim()
+		if err != nil || job.ID != want {
+			t.Fatalf("claimed %v %v, want %s", job, err, want)
+		}
+	}
+	if _, err := q.Claim(); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if ids, _ := q.Scheduled(now.Add(time.Hour), 10); len(ids) != 1 || ids[0] != "late" {
+		t.Fatal(ids)
+	}
+	clock.now = now.Add(time.Minute)
+	if job, err := q.Claim(); err != nil || job.ID != "late" {
+		t.Fatal(job, err)
+	}
+	counts, err := q.Counts()
+	if err != nil || counts != (JobCounts{Active: 4}) {
+		t.Fatal(counts, err)
+	}
+}
+
+func TestJobQueueRetry(t *testing.T) {
+	q, clock := newTestJobQueue(t, WithJobRetryPolicy(Policies(time.Second, 2*time.Second)))
+	q.Enqueue(&Job{ID: "a", Payload: []byte("payload")})
+
+	for attempt, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		job, err := q.Claim()
+		if err != nil || job.Attempt != attempt || string(job.Payload) != "payload" {
+			t.Fatal(job, err)
+		}
+		if dead, err := q.Fail(job, errors.New("boom")); err != nil || dead {
+			t.Fatal(dead, err)
+		}
+		if _, err := q.Claim(); !errors.Is(err, ErrNotFound) {
+			t.Fatal("retried before backoff", err)
+		}
+		clock.now = clock.now.Add(delay)
+	}
+	job, _ := q.Claim()
+	if dead, err := q.Fail(job, errors.New("boom")); err != nil || !dead {
+		t.Fatal(dead, err)
+	}
+	letters, err := q.Dead(0, -1)
+	if err != nil || len(letters) != 1 || letters[0].Attempt != 3 || letters[0].Err != "boom" {
+		t.Fatal(letters, err)
+	}
+	if ok, _ := q.Enqueue(&Job{ID: "a"}); ok {
+		t.Fatal("dead job id reused")
+	}
+	if n, err := q.DeleteDead("a"); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if ok, _ := q.Enqueue(&Job{ID: "a"}); !ok {
+		t.Fatal("deleted job id not reusable")
+	}
+	if ok, err := q.Cancel("a"); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if _, err := q.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+}
+
+func TestJobQueueLease(t *testing.T) {
+	q, clock := newTestJobQueue(t, WithJobLease(time.Second), WithJobRetryPolicy(Policies(time.Second)))
+	q.Enqueue(&Job{ID: "a", Priority: 7, Payload: []byte("payload")})
+	q.Enqueue(&Job{ID: "b", Priority: 1, RunAt: clock.now.Add(time.Hour)})
+	first, _ := q.Claim()
+
+	//租约过期视为一次失败, 按重试延迟重试
+	clock.now = clock.now.Add(2 * time.Second)
+	if _, err := q.Claim(); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expired lease was retried before backoff", err)
+	}
+	job, err := q.Get("a")
+	if err != nil || job.Attempt != 1 || job.Err != "lease expired" || job.Priority != 7 || string(job.Payload) != "payload" {
+		t.Fatal(job, err)
+	}
+	if !job.RunAt.Equal(clock.now.Add(time.Second)) {
+		t.Fatal("retry run at", job.RunAt)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	q.Enqueue(&Job{ID: "d", Priority: 0})
+	second, err := q.Claim()
+	if err != nil || second.ID != "a" || second.Attempt != 1 {
+		t.Fatal("retried job lost its priority", second, err)
+	}
+	if ok, err := q.Complete(second); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if ok, _ := q.Complete(first); ok {
+		t.Fatal("completed twice")
+	}
+	if _, err := q.Complete(&Job{ID: "d"}); err != errJobNotClaimed {
+		t.Fatal(err)
+	}
+	q.Cancel("d")
+
+	//重试耗尽后租约过期进入死信
+	q.Enqueue(&Job{ID: "c", Attempt: 1})
+	q.Claim()
+	clock.now = clock.now.Add(2 * time.Second)
+	if _, err := q.Claim(); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	letters, err := q.Dead(0, -1)
+	if err != nil || len(letters) != 1 || letters[0].ID != "c" || letters[0].Attempt != 2 || letters[0].Err != "lease expired" {
+		t.Fatal(letters, err)
+	}
+}
+
+func TestJobQueueLeaseJitter(t *testing.T) {
+	policy := Policies(time.Minute).WithJitter(0.5)
+	q, clock := newTestJobQueue(t, WithJobLease(time.Second), WithJobRetryPolicy(policy))
+	ids := []string{"a", "b", "c", "d"}
+	for _, id := range ids {
+		q.Enqueue(&Job{ID: id})
+		q.Claim()
+	}
+	clock.now = clock.now.Add(2 * time.Second)
+	q.Claim()
+	runAt := make(map[time.Time]bool)
+	for _, id := range ids {
+		job, err := q.Get(id)
+		if err != nil || !job.RunAt.Equal(clock.now.Add(policy.delay(id, 0, clock.now).Truncate(time.Millisecond))) {
+			t.Fatal("retry delay is not jittered by job id", job, err)
+		}
+		runAt[job.RunAt] = true
+	}
+	if len(runAt) < 2 {
+		t.Fatal("expired jobs share the same jitter", runAt)
+	}
+}
+
+//TestJobQueueStaleLease 租约被其他执行器接管后, 原执行器不能续租, 完成或标记失败
+func TestJobQueueStaleLease(t *testing.T) {
+	q, clock := newTestJobQueue(t, WithJobLease(time.Second), WithJobRetryPolicy(Policies(time.Second, time.Second)))
+	q.Enqueue(&Job{ID: "a"})
+	stale, _ := q.Claim()
+	clock.now = clock.now.Add(2 * time.Second)
+	q.Claim()
+	clock.now = clock.now.Add(time.Second)
+	owner, err := q.Claim()
+	if err != nil || owner.ID != "a" || owner.Token == stale.Token {
+		t.Fatal(owner, err)
+	}
+
+	if ok, err := q.Complete(stale); err != nil || ok {
+		t.Fatal("stale worker completed the job", ok, err)
+	}
+	if dead, err := q.Fail(stale, errors.New("boom")); err != nil || dead {
+		t.Fatal("stale worker failed the job", dead, err)
+	}
+	if counts, _ := q.Counts(); counts != (JobCounts{Active: 1}) {
+		t.Fatal("stale worker moved the job", counts)
+	}
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	q.renew(map[string]string{"a": stale.Token})
+	if job, _ := q.Get("a"); job.Attempt != 1 {
+		t.Fatal(job)
+	}
+	deadline, _ := q.cache.ZScore(q.key(JobActiveSuffix), []byte("a"))
+	if deadline != float64(toMillis(clock.now.Add(500*time.Millisecond))) {
+		t.Fatal("stale worker renewed the lease", deadline)
+	}
+	q.renew(map[string]string{"a": owner.Token})
+	if deadline, _ := q.cache.ZScore(q.key(JobActiveSuffix), []byte("a")); deadline != float64(toMillis(clock.now.Add(time.Second))) {
+		t.Fatal("owner did not renew the lease", deadline)
+	}
+	if ok, err := q.Complete(owner); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestJobQueueDeleteDead(t *testing.T) {
+	q, _ := newTestJobQueue(t, WithJobRetryPolicy(Policies(time.Second)))
+	q.Enqueue(&Job{ID: "dead", Attempt: 1})
+	job, _ := q.Claim()
+	q.Fail(job, errors.New("boom"))
+	q.Enqueue(&Job{ID: "pending", RunAt: time.Unix(1800000000, 0)})
+
+	if n, err := q.DeleteDead("dead", "pending", "none"); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if _, err := q.Get("dead"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if job, err := q.Get("pending"); err != nil || job.ID != "pending" {
+		t.Fatal("deleted a job which is not dead", job, err)
+	}
+	if n, err := q.DeleteDead(); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+}
+
+func TestJobWorker(t *testing.T) {
+	q, _ := newTestJobQueue(t)
+	q.clock = systemClock{}
+	for i := 0; i < 20; i++ {
+		q.Enqueue(&Job{ID: strconv.Itoa(i), Priority: i % 3})
+	}
+
+	var running, maxRunning, handled int32
+	var seen sync.Map
+	worker, err := q.Work(context.Background(), func(ctx context.Context, job *Job) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		if _, loaded := seen.LoadOrStore(job.ID, true); loaded {
+			t.Error("job handled twice", job.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, WithJobWorkers(4), WithJobPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&handled) < 20 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	worker.Stop()
+	if handled != 20 || maxRunning < 2 || maxRunning > 4 {
+		t.Fatal(handled, maxRunning)
+	}
+	if counts, _ := q.Counts(); counts != (JobCounts{}) {
+		t.Fatal(counts)
+	}
+
+	q.Enqueue(&Job{ID: "slow"})
+	started := make(chan struct{})
+	var finished int32
+	worker, _ = q.Work(context.Background(), func(ctx context.Context, job *Job) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return nil
+	}, WithJobPollInterval(10*time.Millisecond))
+	<-started
+	worker.Stop()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("stop did not wait for the running job")
+	}
+	if _, err := q.Get("slow"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("job not completed before stop returned", err)
+	}
+}
@@ -0,0 +1,182 @@
+package redisplus
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/redis.v5"
+	"strings"
+	"time"
+)
+
+// ErrKeyNotExist 同时满足 errors.Is(err, ErrNotFound)
+var ErrKeyNotExist = fmt.Errorf("key does not exist: %w", ErrNotFound)
+var ErrKeyNoExpire = errors.New("key has no associated expire")
+
+//toTTL 将 TTL/PTTL 的 -2/-1 结果转换为 ErrKeyNotExist/ErrKeyNoExpire
+func toTTL(ttl time.Duration, precision time.Duration, err error) (time.Duration, error) {
+	if nil != err {
+		return 0, err
+	}
+	switch ttl {
+	case -2 * precision:
+		return 0, ErrKeyNotExist
+	case -1 * precision:
+		return 0, ErrKeyNoExpire
+	}
+	return ttl, nil
+}
+
+// TTL key 不存在时返回 ErrKeyNotExist, 没有过期时间时返回 ErrKeyNoExpire
+func (r *redisView) TTL(key string) (time.Duration, error) {
+	ttl, err := r.cmd.TTL(r.expandKey(key)).Result()
+	ttl, err = toTTL(ttl, time.Second, err)
+	return ttl, wrapError("ttl", r.expandKey(key), err)
+}
+
+// PTTL key 不存在时返回 ErrKeyNotExist, 没有过期时间时返回 ErrKeyNoExpire
+func (r *redisView) PTTL(key string) (time.Duration, error) {
+	ttl, err := r.cmd.PTTL(r.expandKey(key)).Result()
+	ttl, err = toTTL(ttl, time.Millisecond, err)
+	return ttl, wrapError("pttl", r.expandKey(key), err)
+}
+
+// Persist 移除过期时间, key 不存在或没有过期时间时返回 false
+func (r *redisView) Persist(key string) (bool, error) {
+	result, err := r.cmd.Persist(r.expandKey(key)).Result()
+	if nil != err {
+		return false, wrapError("persist", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// ExpireAt 在 at 时过期, 精度为毫秒, key 不存在时返回 false
+func (r *redisView) ExpireAt(key string, at time.Time) (bool, error) {
+	result, err := r.cmd.PExpireAt(r.expandKey(key), at).Result()
+	if nil != err {
+		return false, wrapError("pexpireat", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// Exists 返回存在的 key 数量, 集群模式下按 slot 拆分执行
+func (r *redisView) Exists(keys ...string) (int64, error) {
+	return r.sumBySlot("exists", keys, func(slotKeys []string) (int64, error) {
+		return r.cmd.ExistsMulti(slotKeys...).Result()
+	})
+}
+
+// Type key 不存在时返回 ErrKeyNotExist
+func (r *redisView) Type(key string) (string, error) {
+	result, err := r.cmd.Type(r.expandKey(key)).Result()
+	if nil != err {
+		return "", wrapError("type", r.expandKey(key), err)
+	}
+	if result == "none" {
+		return "", wrapError("type", r.expandKey(key), ErrKeyNotExist)
+	}
+	return result, nil
+}
+
+// Rename newKey 与 key 使用相同的前缀, 集群模式下必须在同一个 slot
+func (r *redisView) Rename(key, newKey string) error {
+	from, to := r.expandKey(key), r.expandKey(newKey)
+	if err := r.sameSlot(from, to); err != nil {
+		return err
+	}
+	return wrapError("rename", from, wrapResult(func() (interface{}, error) {
+		return r.cmd.Rename(from, to).Result()
+	}))
+}
+
+// RenameNX newKey 不存在时才重命名
+func (r *redisView) RenameNX(key, newKey string) (bool, error) {
+	from, to := r.expandKey(key), r.expandKey(newKey)
+	if err := r.sameSlot(from, to); err != nil {
+		return false, err
+	}
+	result, err := r.cmd.RenameNX(from, to).Result()
+	if nil != err {
+		return false, wrapError("renamenx", from, err)
+	}
+	return result, nil
+}
+
+// Copy 复制 key 到同一前缀下的 destination, replace 为 false 时 destination 已存在则不复制, 需要 redis 6.2
+func (r *redisView) Copy(key, destination string, replace bool) (bool, error) {
+	from, to := r.expandKey(key), r.expandKey(destination)
+	if err := r.sameSlot(from, to); err != nil {
+		return false, err
+	}
+	args := []interface{}{"copy", from, to}
+	if replace {
+		args = append(args, "replace")
+	}
+	cmd := redis.NewBoolCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return false, wrapError("copy", from, err)
+	}
+	result, err := cmd.Result()
+	if nil != err {
+		return false, wrapError("copy", from, err)
+	}
+	return result, nil
+}
+
+// Touch 更新 key 的最后访问时间, 返回存在的 key 数量
+func (r *redisView) Touch(keys ...string) (int64, error) {
+	return r.sumBySlot("touch", keys, func(slotKeys []string) (int64, error) {
+		args := []interface{}{"touch"}
+		for _, key := range slotKeys {
+			args = append(args, key)
+		}
+		cmd := redis.NewIntCmd(args...)
+		if err := r.cmd.Process(cmd); err != nil {
+			return 0, err
+		}
+		return cmd.Result()
+	})
+}
+
+// Unlink 在后台释放 key 的内存, 返回删除的 key 数量
+func (r *redisView) Unlink(keys ...string) (int64, error) {
+	return r.sumBySlot("unlink", keys, func(slotKeys []string) (int64, error) {
+		args := []interface{}{"unlink"}
+		for _, key := range slotKeys {
+			args = append(args, key)
+		}
+		cmd := redis.NewIntCmd(args...)
+		if err := r.cmd.Process(cmd); err != nil {
+			return 0, err
+		}
+		return cmd.Result()
+	})
+}
+
+//sumBySlot 按 slot 拆分执行多 key 命令并累加结果
+func (r *redisView) sumBySlot(command string, keys []string, call func(slotKeys []string) (int64, error)) (int64, error) {
+	all := make([]string, 0, len(keys))
+	for _, key := range keys {
+		all = append(all, r.expandKey(key))
+	}
+	var total int64
+	for _, group := range r.groupBySlot(all) {
+		slotKeys := make([]string, 0, len(group))
+		for _, idx := range group {
+			slotKeys = append(slotKeys, all[idx])
+		}
+		count, err := call(slotKeys)
+		if nil != err {
+			return total, wrapError(command, strings.Join(slotKeys, " "), err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+//sameSlot 集群模式下检查完整 key 是否在同一个 slot
+func (r *redisView) sameSlot(keys ...string) error {
+	if len(r.groupBySlot(keys)) > 1 {
+		return ErrCrossSlot
+	}
+	return nil
+}
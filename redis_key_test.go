@@ -0,0 +1,105 @@
+package redisplus
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestKeyExpire(t *testing.T) {
+	s, view := newTestView(t)
+	if _, err := view.TTL("none"); !errors.Is(err, ErrKeyNotExist) || !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	view.SetDuration("k", []byte("v"), 0)
+	if _, err := view.PTTL("k"); !errors.Is(err, ErrKeyNoExpire) {
+		t.Fatal(err)
+	}
+	view.ExpireDuration("k", 1500*time.Millisecond)
+	if ttl, err := view.PTTL("k"); err != nil || ttl != 1500*time.Millisecond {
+		t.Fatal(ttl, err)
+	}
+	if ttl, err := view.TTL("k"); err != nil || ttl != time.Second {
+		t.Fatal(ttl, err)
+	}
+	if ok, err := view.Persist("k"); err != nil || !ok || s.TTL("TEST:dev:k") != 0 {
+		t.Fatal(ok, err)
+	}
+	if ok, _ := view.Persist("k"); ok {
+		t.Fatal("persist without ttl")
+	}
+
+	now := time.Unix(1700000000, 0)
+	s.SetTime(now)
+	if ok, err := view.ExpireAt("k", now.Add(time.Hour)); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if ttl := s.TTL("TEST:dev:k"); ttl != time.Hour {
+		t.Fatal(ttl)
+	}
+	if ok, _ := view.ExpireAt("none", now.Add(time.Hour)); ok {
+		t.Fatal("expireat on missing key")
+	}
+}
+
+func TestKeyCommands(t *testing.T) {
+	s, view := newTestView(t)
+	view.SetDuration("a", []byte("1"), 0)
+	view.HSet("h", "f", []byte("v"))
+
+	if n, err := view.Exists("a", "h", "none"); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if kind, err := view.Type("h"); err != nil || kind != "hash" {
+		t.Fatal(kind, err)
+	}
+	if _, err := view.Type("none"); !errors.Is(err, ErrKeyNotExist) {
+		t.Fatal(err)
+	}
+
+	if err := view.Rename("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := sortedKeys(s.Keys()); !reflect.DeepEqual(keys, []string{"TEST:dev:b", "TEST:dev:h"}) {
+		t.Fatal(keys)
+	}
+	if err := view.Rename("none", "c"); err == nil {
+		t.Fatal("rename of missing key")
+	}
+	if ok, err := view.RenameNX("b", "h"); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+
+	if ok, err := view.Copy("b", "c", false); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if ok, _ := view.Copy("h", "c", false); ok {
+		t.Fatal("copy over existing key without replace")
+	}
+	if ok, err := view.Copy("h", "c", true); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if keys := sortedKeys(s.Keys()); !reflect.DeepEqual(keys, []string{"TEST:dev:b", "TEST:dev:c", "TEST:dev:h"}) {
+		t.Fatal(keys)
+	}
+	if s.HGet("TEST:dev:c", "f") != "v" {
+		t.Fatal("copy with replace did not overwrite")
+	}
+
+	if n, err := view.Touch("b", "c", "none"); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if n, err := view.Unlink("b", "c", "none"); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if keys := s.Keys(); !reflect.DeepEqual(keys, []string{"TEST:dev:h"}) {
+		t.Fatal(keys)
+	}
+}
+
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
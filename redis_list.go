@@ -1,27 +1,38 @@
 package redisplus
 
+import (
+	"context"
+	"gopkg.in/redis.v5"
+	"strings"
+	"time"
+)
+
 func (r *redisView) LRem(key string, count int64, value []byte) (int64, error) {
-	return r.cmd.LRem(r.expandKey(key), count, value).Result()
+	result, err := r.cmd.LRem(r.expandKey(key), count, value).Result()
+	if nil != err {
+		return 0, wrapError("lrem", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) LIndex(key string, index int64) ([]byte, error) {
 	result, err := r.cmd.LIndex(r.expandKey(key), index).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("lindex", r.expandKey(key), err)
 	}
 	return []byte(result), nil
 }
 
 func (r *redisView) LTrim(key string, start, stop int64) error {
-	return wrapResult(func() (interface{}, error) {
+	return wrapError("ltrim", r.expandKey(key), wrapResult(func() (interface{}, error) {
 		return r.cmd.LTrim(r.expandKey(key), start, stop).Result()
-	})
+	}))
 }
 
 func (r *redisView) LSet(key string, index int64, value []byte) error {
-	return wrapResult(func() (interface{}, error) {
+	return wrapError("lset", r.expandKey(key), wrapResult(func() (interface{}, error) {
 		return r.cmd.LSet(r.expandKey(key), index, value).Result()
-	})
+	}))
 }
 
 func (r *redisView) LPush(key string, values ...[]byte) (int64, error) {
@@ -29,7 +40,11 @@ func (r *redisView) LPush(key string, values ...[]byte) (int64, error) {
 	for _, value := range values {
 		vals = append(vals, value)
 	}
-	return r.cmd.LPush(r.expandKey(key), vals...).Result()
+	result, err := r.cmd.LPush(r.expandKey(key), vals...).Result()
+	if nil != err {
+		return 0, wrapError("lpush", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) LAppend(key string, values ...[]byte) (int64, error) {
@@ -37,13 +52,17 @@ func (r *redisView) LAppend(key string, values ...[]byte) (int64, error) {
 	for _, value := range values {
 		vals = append(vals, value)
 	}
-	return r.cmd.RPush(r.expandKey(key), vals...).Result()
+	result, err := r.cmd.RPush(r.expandKey(key), vals...).Result()
+	if nil != err {
+		return 0, wrapError("rpush", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) LPop(key string) ([]byte, error) {
 	result, err := r.cmd.LPop(r.expandKey(key)).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("lpop", r.expandKey(key), err)
 	}
 	return []byte(result), nil
 }
@@ -51,21 +70,146 @@ func (r *redisView) LPop(key string) ([]byte, error) {
 func (r *redisView) LRPop(key string) ([]byte, error) {
 	result, err := r.cmd.RPop(r.expandKey(key)).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("rpop", r.expandKey(key), err)
 	}
 	return []byte(result), nil
 }
 
 func (r *redisView) LRange(key string, start, stop int64) ([][]byte, error) {
-	return wrapSliceStringToSliceBytes(func() ([]string, error) {
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
 		return r.cmd.LRange(r.expandKey(key), start, stop).Result()
 	})
+	if nil != err {
+		return nil, wrapError("lrange", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) LLen(key string) (int64, error) {
-	return r.cmd.LLen(r.expandKey(key)).Result()
+	result, err := r.cmd.LLen(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("llen", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) LInsert(key string, op InsertOP, pivot, value []byte) (int64, error) {
-	return r.cmd.LInsert(r.expandKey(key), string(op), pivot, value).Result()
+	result, err := r.cmd.LInsert(r.expandKey(key), string(op), pivot, value).Result()
+	if nil != err {
+		return 0, wrapError("linsert", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// LPos 返回 value 的下标, rank 为 0 时返回第一个, 为负数时从尾部查找, 不存在时返回 ErrNotFound, 需要 redis 6.0.6
+func (r *redisView) LPos(key string, value []byte, rank int64) (int64, error) {
+	args := []interface{}{"lpos", r.expandKey(key), value}
+	if rank != 0 {
+		args = append(args, "rank", rank)
+	}
+	cmd := redis.NewCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return 0, wrapError("lpos", r.expandKey(key), err)
+	}
+	index, ok := cmd.Val().(int64)
+	if !ok {
+		return 0, wrapError("lpos", r.expandKey(key), ErrNotFound)
+	}
+	return index, nil
+}
+
+// LMove destination 与 source 使用相同的前缀, 集群模式下必须在同一个 slot, source 为空时返回 ErrNotFound, 需要 redis 6.2
+func (r *redisView) LMove(source, destination string, from, to ListSide) ([]byte, error) {
+	src, dest := r.expandKey(source), r.expandKey(destination)
+	if err := r.sameSlot(src, dest); err != nil {
+		return nil, err
+	}
+	cmd := redis.NewStringCmd("lmove", src, dest, from.String(), to.String())
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("lmove", src, err)
+	}
+	result, err := cmd.Bytes()
+	if nil != err {
+		return nil, wrapError("lmove", src, err)
+	}
+	return result, nil
+}
+
+// RPopLPush source 为空时返回 ErrNotFound
+func (r *redisView) RPopLPush(source, destination string) ([]byte, error) {
+	src, dest := r.expandKey(source), r.expandKey(destination)
+	if err := r.sameSlot(src, dest); err != nil {
+		return nil, err
+	}
+	result, err := r.cmd.RPopLPush(src, dest).Bytes()
+	if nil != err {
+		return nil, wrapError("rpoplpush", src, err)
+	}
+	return result, nil
+}
+
+// BLPop 阻塞直到任一 key 非空或 ctx 结束, 返回不带前缀的 key.
+// ctx 结束最多延迟 1s 生效, 集群模式下 keys 必须在同一个 slot
+func (r *redisView) BLPop(ctx context.Context, keys ...string) (string, []byte, error) {
+	return r.bPop(ctx, "blpop", keys, r.cmd.BLPop)
+}
+
+// BRPop 同 BLPop, 从尾部弹出
+func (r *redisView) BRPop(ctx context.Context, keys ...string) (string, []byte, error) {
+	return r.bPop(ctx, "brpop", keys, r.cmd.BRPop)
+}
+
+func (r *redisView) bPop(ctx context.Context, command string, keys []string,
+	call func(timeout time.Duration, keys ...string) *redis.StringSliceCmd) (string, []byte, error) {
+	all := r.expandKeys(keys)
+	if err := r.sameSlot(all...); err != nil {
+		return "", nil, err
+	}
+	var result []string
+	err := blockingCall(ctx, func() (err error) {
+		result, err = call(blockingStep, all...).Result()
+		return err
+	})
+	if nil != err {
+		return "", nil, wrapError(command, strings.Join(all, " "), err)
+	}
+	if len(result) != 2 {
+		return "", nil, wrapError(command, strings.Join(all, " "), ErrorResultNotOK)
+	}
+	return r.truncateKey(result[0]), []byte(result[1]), nil
+}
+
+// BLMove 阻塞直到 source 非空或 ctx 结束, 需要 redis 6.2
+func (r *redisView) BLMove(ctx context.Context, source, destination string, from, to ListSide) ([]byte, error) {
+	src, dest := r.expandKey(source), r.expandKey(destination)
+	if err := r.sameSlot(src, dest); err != nil {
+		return nil, err
+	}
+	var cmd *redis.StringCmd
+	err := blockingCall(ctx, func() error {
+		cmd = redis.NewStringCmd("blmove", src, dest, from.String(), to.String(), blockingSeconds)
+		return r.cmd.Process(cmd)
+	})
+	if nil != err {
+		return nil, wrapError("blmove", src, err)
+	}
+	result, err := cmd.Bytes()
+	if nil != err {
+		return nil, wrapError("blmove", src, err)
+	}
+	return result, nil
+}
+
+// BRPopLPush 阻塞直到 source 非空或 ctx 结束
+func (r *redisView) BRPopLPush(ctx context.Context, source, destination string) ([]byte, error) {
+	src, dest := r.expandKey(source), r.expandKey(destination)
+	if err := r.sameSlot(src, dest); err != nil {
+		return nil, err
+	}
+	var value []byte
+	err := blockingCall(ctx, func() (err error) {
+		value, err = r.cmd.BRPopLPush(src, dest, blockingStep).Bytes()
+		return err
+	})
+	return value, wrapError("brpoplpush", src, err)
 }
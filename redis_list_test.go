@@ -0,0 +1,127 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestListMove(t *testing.T) {
+	s, view := newTestView(t)
+	view.LAppend("src", []byte("a"), []byte("b"), []byte("c"))
+
+	if index, err := view.LPos("src", []byte("b"), 0); err != nil || index != 1 {
+		t.Fatal(index, err)
+	}
+	if _, err := view.LPos("src", []byte("x"), 0); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if value, err := view.LMove("src", "dst", ListSide_LEFT, ListSide_RIGHT); err != nil || string(value) != "a" {
+		t.Fatal(value, err)
+	}
+	if value, err := view.RPopLPush("src", "dst"); err != nil || string(value) != "c" {
+		t.Fatal(value, err)
+	}
+	if _, err := view.RPopLPush("none", "dst"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	keys := s.Keys()
+	sort.Strings(keys)
+	if want := []string{"TEST:dev:dst", "TEST:dev:src"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("touched %v, want %v", keys, want)
+	}
+	if list, _ := s.List("TEST:dev:dst"); !reflect.DeepEqual(list, []string{"c", "a"}) {
+		t.Fatal(list)
+	}
+}
+
+func TestListBlocking(t *testing.T) {
+	_, view := newTestView(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := view.BLPop(ctx, "q1", "q2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		view.LAppend("q2", []byte("a"), []byte("b"))
+	}()
+	key, value, err := view.BRPop(context.Background(), "q1", "q2")
+	if err != nil || key != "q2" || string(value) != "b" {
+		t.Fatal(key, value, err)
+	}
+	if value, err := view.BLMove(context.Background(), "q2", "q3", ListSide_LEFT, ListSide_LEFT); err != nil || string(value) != "a" {
+		t.Fatal(value, err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		view.LPush("q1", []byte("c"))
+	}()
+	if value, err := view.BRPopLPush(context.Background(), "q1", "q3"); err != nil || string(value) != "c" {
+		t.Fatal(value, err)
+	}
+}
+
+func TestReliableQueue(t *testing.T) {
+	s, view := newTestView(t)
+	clock := &manualClock{now: time.Now()}
+	q, err := NewReliableQueue(view, "jobs", WithVisibilityTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.clock = clock
+	if _, err := NewReliableQueue(view, "jobs", WithVisibilityTimeout(time.Second)); err == nil {
+		t.Fatal("visibility timeout below minimum")
+	}
+
+	q.Push([]byte("1"), []byte("2"), []byte("3"))
+	ctx := context.Background()
+	first, err := q.Consume(ctx, "c1")
+	if err != nil || string(first) != "1" {
+		t.Fatal(first, err)
+	}
+	second, _ := q.Consume(ctx, "c1")
+	if ok, err := q.Ack("c1", first); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if ok, err := q.Nack("c1", second); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if value, _ := q.Consume(ctx, "c2"); string(value) != "2" {
+		t.Fatal("nacked item is not consumed first", string(value))
+	}
+	q.Consume(ctx, "c2")
+	if pending, _ := q.Pending("c2"); len(pending) != 2 || string(pending[0]) != "3" {
+		t.Fatal(pending)
+	}
+
+	if n, err := q.Reap(); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+	clock.now = clock.now.Add(11 * time.Second)
+	q.Heartbeat("c1")
+	if n, err := q.Reap(); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if list, _ := s.List("TEST:dev:jobs"); !reflect.DeepEqual(list, []string{"3", "2"}) {
+		t.Fatal(list)
+	}
+	if members, _ := s.ZMembers("{TEST:dev:jobs}:CONSUMERS"); !reflect.DeepEqual(members, []string{"c1"}) {
+		t.Fatal(members)
+	}
+	for _, key := range s.Keys() {
+		if KeySlot(key) != KeySlot("TEST:dev:jobs") {
+			t.Fatal("key is not in the queue slot", key)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := q.Consume(cancelled, "c3"); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
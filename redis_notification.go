@@ -7,6 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
+	"gopkg.in/redis.v5"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -20,6 +23,7 @@ var errKeyFormat = errors.New("key format error")
 const NotifyKeyPrefix = "NOTIFY"
 const NotifyValuePrefix = "NOTIFY_VALUE"
 const NotifyLockPrefix = "NOTIFY_LOCK"
+const NotifyStatePrefix = "NOTIFY_STATE"
 
 type PutNext bool
 type NotificationHandler func(p *Entity, err error) PutNext
@@ -36,21 +40,50 @@ func DefaultRetryPolicies() []time.Duration {
 }
 
 type Entity struct {
-	count int64
+	count  int64
+	token  string //当前节点持有的通知锁或处理租约的值
+	legacy bool   //由升级前不带 hash tag 的通知 key 还原, value, 状态与锁使用旧的 key
 	Key   string
 	Value []byte
 }
 
+//base64 编码的 Key, 避免 Key 中的分隔符影响解析
+func (e *Entity) encodedKey() string {
+	return base64.StdEncoding.EncodeToString([]byte(e.Key))
+}
+
+//hash tag, 集群模式下同一个 Entity 的通知, value, 状态与锁在同一个 slot.
+//升级前写入的通知不带 hash tag
+func (e *Entity) tag() string {
+	if e.legacy {
+		return e.encodedKey()
+	}
+	return "{" + e.encodedKey() + "}"
+}
+
+//isLegacyTag 通知 key 中的编码段是否为升级前不带 hash tag 的格式
+func isLegacyTag(encodedKey string) bool {
+	return !strings.HasPrefix(encodedKey, "{")
+}
+
 //通知key
 func (e *Entity) notifyKey() string {
-	key := base64.StdEncoding.EncodeToString([]byte(e.Key))
-	return fmt.Sprintf("%s:%s:%d", NotifyKeyPrefix, key, e.count)
+	return fmt.Sprintf("%s:%s:%d", NotifyKeyPrefix, e.tag(), e.count)
 }
 
 //通知 value key
 func (e *Entity) valueKey() string {
-	key := base64.StdEncoding.EncodeToString([]byte(e.Key))
-	return fmt.Sprintf("%s:%s", NotifyValuePrefix, key)
+	return fmt.Sprintf("%s:%s", NotifyValuePrefix, e.tag())
+}
+
+// Count 返回通知当前的重试次数, 从 0 开始
+func (e *Entity) Count() int64 {
+	return e.count
+}
+
+//通知状态 key, 记录当前重试次数
+func (e *Entity) stateKey() string {
+	return fmt.Sprintf("%s:%s", NotifyStatePrefix, e.tag())
 }
 
 func (e *Entity) String()string{
@@ -60,7 +93,33 @@ func (e *Entity) String()string{
 
 type Notification interface {
 	PutNotification(p *Entity) error
-	Subscribe(handler NotificationHandler) error
+	// PutNotificationMode 按 mode 原子地写入通知, 同一个 Key 最多只有一个等待触发的通知,
+	// 返回是否写入
+	PutNotificationMode(p *Entity, mode PutMode) (bool, error)
+	// Subscribe 订阅过期通知, 返回的 Subscription 用于停止订阅
+	Subscribe(handler NotificationHandler, opts ...SubscribeOption) (Subscription, error)
+	// SubscribeDelivery 与 Subscribe 相同, handler 可以获取触发上下文并指定重试方式
+	SubscribeDelivery(handler DeliveryHandler, opts ...SubscribeOption) (Subscription, error)
+
+	// DeadLetters 列出所有重试策略已用完的通知
+	DeadLetters() ([]*DeadLetter, error)
+	// DeadLetter 查看指定 key 的死信
+	DeadLetter(key string) (*DeadLetter, error)
+	// Requeue 将死信从第一次重试开始重新投递
+	Requeue(key string) error
+	// Purge 删除指定 key 的死信, 不指定 key 时删除全部死信
+	Purge(keys ...string) (int64, error)
+
+	// Get 查看指定 key 等待触发的通知
+	Get(key string) (*PendingNotification, error)
+	// Cancel 取消指定 key 等待触发的通知
+	Cancel(key string) error
+	// Reschedule 将指定 key 等待触发的通知改为在 at 触发
+	Reschedule(key string, at time.Time) error
+	// Pending 分页列出等待触发的通知, cursor 从 0 开始, 返回的 cursor 为 0 时表示结束.
+	// 与 SCAN 相同, 某一页可能为空而 cursor 不为 0, 需要继续调用直到 cursor 为 0.
+	// keyspace 通知的 cursor 包含节点序号, 集群模式下依次扫描每个 master 节点
+	Pending(cursor uint64) ([]*PendingNotification, uint64, error)
 }
 
 type policies []time.Duration
@@ -75,22 +134,33 @@ func (po policies) length() int {
 	return len(po)
 }
 
-func (po policies) holding() time.Duration  {
-	if len(po) == 0 {
-		return 0
-	}
-	return po[len(po)-1] + time.Duration(5) * time.Minute
-}
-
 type notification struct {
 	prefix   string
 	node     string
 	cache    RedisCli
 	policies policies
+	retry    RetryPolicy
+	lockTTL  time.Duration
+	holding  time.Duration //value 在最后一次触发之后的保留时间
+	workers  int           //订阅默认的 worker 数量
+	clock    Clock
 	logger   Logger
+	observer Observer
+	tagged   bool //所有 key 使用 {prefix} 作为 hash tag
+	//schedule 在 delay 之后投递通知, 由具体的存储实现提供
+	schedule func(p *Entity, delay time.Duration) error
 }
 
-func NewNotification(prefix string, cache RedisCli, logger Logger, policies ...[]time.Duration) (Notification, error) {
+// NewNotification 创建基于 keyspace 过期事件的通知, 未指定重试策略时使用 DefaultRetryPolicies
+func NewNotification(prefix string, cache RedisCli, opts ...NotificationOption) (Notification, error) {
+	n, err := newNotification(prefix, cache, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func newNotification(prefix string, cache RedisCli, opts ...NotificationOption) (*notification, error) {
 
 	if "" == prefix {
 		return nil, errPrefixNotNil
@@ -99,26 +169,43 @@ func NewNotification(prefix string, cache RedisCli, logger Logger, policies ...[
 		return nil, errRedisNotNil
 	}
 
+	policy := Policies(DefaultRetryPolicies()...)
 	n := &notification{
-		prefix: prefix,
-		node:   fmt.Sprintf("%s:%d", GetLocalIP(), os.Getpid()),
-		cache:  cache,
-		logger: logger,
-	}
-
-	if 0 == len(policies) {
-		n.policies = DefaultRetryPolicies()
-	} else {
-		n.policies = policies[0]
-		err := checkPoliciesSequence(n)
-		if err != nil {
+		prefix:   prefix,
+		node:     fmt.Sprintf("%s:%d", GetLocalIP(), os.Getpid()),
+		cache:    cache,
+		policies: policy.delays,
+		retry:    policy,
+		lockTTL:  defaultLockTTL,
+		holding:  defaultValueHolding,
+		workers:  defaultWorkers,
+		clock:    systemClock{},
+		logger:   nopLogger{},
+		observer: noopObserver{},
+	}
+	n.schedule = n.put
+
+	for _, opt := range opts {
+		if err := opt(n); err != nil {
 			return nil, err
 		}
 	}
+	if err := checkPoliciesSequence(n); err != nil {
+		return nil, err
+	}
 
 	return n, nil
 }
 
+//holdingAfter value 的缓存时间, 至少保留到 delay 之后的触发
+func (n *notification) holdingAfter(delay time.Duration) time.Duration {
+	holding := n.policies.last() + n.holding
+	if after := delay + n.holding; after > holding {
+		return after
+	}
+	return holding
+}
+
 //checkPoliciesSequence 检查策略是否为一个升序序列
 func checkPoliciesSequence(n *notification) error{
 	if len(n.policies) > 1 {
@@ -131,83 +218,126 @@ func checkPoliciesSequence(n *notification) error{
 	return nil
 }
 
+//delay 第 attempt 次触发的延迟
+func (n *notification) delay(p *Entity, attempt int64) time.Duration {
+	return n.retry.delay(p.Key, int(attempt), n.clock.Now())
+}
+
 func (n *notification) PutNotification(p *Entity) error {
-	if err := n.cache.Set(n.prefix+":"+p.notifyKey(), []byte{}, n.policies[p.count].String()); err != nil {
+	return n.put(p, n.delay(p, p.count))
+}
+
+func (n *notification) put(p *Entity, delay time.Duration) error {
+	if err := n.set(p.notifyKey(), []byte{}, delay); err != nil {
 		return err
 	}
 
 	//设置value的最大缓存过期时间为重试policy的最大时间
-	if err := n.cache.Set(n.prefix+":"+p.valueKey(), p.Value, n.policies.holding().String()); err != nil {
+	if err := n.set(p.valueKey(), p.Value, n.holdingAfter(delay)); err != nil {
+		return err
+	}
+	if err := n.putState(p, delay); err != nil {
 		return err
 	}
+	n.observer.Observe(n.prefix, EventScheduled)
 	return nil
 }
 
-func (n *notification) Subscribe(handler NotificationHandler) error {
-	space := fmt.Sprintf("__keyspace@*__:%s:%s:%s:*", n.cache.KeyPrefix(), n.prefix, NotifyKeyPrefix)
-	n.logger.Info("psubscribe key", "pattern", space)
-	psub, err := n.cache.PSubscribe(space)
-	if nil != err {
+//set 写入 value, 不使用 view 的默认过期时间, 通知的 key 必须按 ttl 过期
+func (n *notification) set(suffix string, value []byte, ttl time.Duration) error {
+	key := n.fullKey(suffix)
+	return wrapError("set", key, n.cache.NativeCmd().Set(key, value, ttl).Err())
+}
+
+//putState 记录通知当前的重试次数与计划触发时间, 用于恢复丢失的过期事件
+func (n *notification) putState(p *Entity, delay time.Duration) error {
+	key := n.key(p.stateKey())
+	state := map[string][]byte{
+		stateCountField: []byte(strconv.FormatInt(p.count, 10)),
+		stateDueField:   []byte(strconv.FormatInt(toMillis(n.clock.Now().Add(delay)), 10)),
+	}
+	if err := n.cache.HMSet(key, state); err != nil {
 		return err
 	}
+	return n.cache.ExpireDuration(key, n.holdingAfter(delay))
+}
 
-	go func() {
-		for {
-			message, err := psub.ReceiveMessage()
-			if nil != err {
-				continue
-			}
-			if message.Payload != "expired" {
-				continue
-			}
+//fetchCount 读取通知状态中记录的重试次数
+func (n *notification) fetchCount(p *Entity) (int64, error) {
+	value, err := n.cache.HGet(n.key(p.stateKey()), stateCountField)
+	if nil != err {
+		return 0, err
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
 
-			entity, err := n.decode(message.Channel)
-			if nil != err {
-				n.logger.Error("decode message", "key",message.Channel, "err", err)
-				continue
-			}
+//fetchDue 读取通知状态中记录的计划触发时间
+func (n *notification) fetchDue(p *Entity) (time.Time, error) {
+	value, err := n.cache.HGet(n.key(p.stateKey()), stateDueField)
+	if nil != err {
+		return time.Time{}, err
+	}
+	millis, err := strconv.ParseInt(string(value), 10, 64)
+	if nil != err {
+		return time.Time{}, err
+	}
+	return fromMillis(float64(millis)), nil
+}
 
-			locked, err :=n.lock(entity)
-			if nil != err {
-				n.logger.Error("lock entity", "key", entity, "err", err)
-				continue
-			}
-			//locked by another process
-			if !locked{
-				continue
-			}
+//finish 通知不再投递, 清理value与状态
+func (n *notification) finish(p *Entity) {
+	if _, err := n.cache.Del(n.key(p.valueKey()), n.key(p.stateKey())); err != nil {
+		n.logger.Error("finish entity", "entity", p, "err", err)
+	}
+}
 
-			err = n.fetchValue(entity)
-			putNext := handler(entity, err)
-			entity.count += 1
-			if putNext && entity.count < int64(n.policies.length()) {
-				if err := n.PutNotification(entity); err != nil {
-					n.logger.Error("requeue entity", "entity", entity, "err", err)
-					continue
-				}
-			}
-			if !putNext || (putNext && entity.count >= int64(n.policies.length())) {
-				n.unlock(entity)
-			}
-		}
-	}()
-	return nil
+func (n *notification) Subscribe(handler NotificationHandler, opts ...SubscribeOption) (Subscription, error) {
+	return n.SubscribeDelivery(adaptHandler(handler), opts...)
 }
 
-//decode value from TEST:dev:order:NOTIFY:NjI0YjVhNWYtNjA5Ny00YTgzLTkxMWYtNmU2N2NhYjZlOWJh:1
-//return Entity
-func (n *notification) decode(src string) (*Entity, error) {
-	keys := strings.Split(src, ":")
+func (n *notification) SubscribeDelivery(handler DeliveryHandler, opts ...SubscribeOption) (Subscription, error) {
+	o := newSubscribeOptions(n.workers, opts...)
+	if err := n.checkKeyspaceEvents(o.enableKeyspaceEvents); err != nil {
+		return nil, err
+	}
+	space := fmt.Sprintf("__keyspace@*__:%s", n.fullKey(NotifyKeyPrefix+RedisKeySep+"*"))
+	n.logger.Info("psubscribe key", "pattern", space)
+	psub, err := n.cache.PSubscribe(space)
+	if nil != err {
+		return nil, err
+	}
+
+	s := newSubscription(n, &keyspaceSource{n: n, psub: psub}, handler, o)
+	go s.run()
+	return s, nil
+}
+
+//DecodeNotifyKey 由通知 key 还原 Entity
+//例如 TEST:dev:order:NOTIFY:{NjI0YjVhNWYtNjA5Ny00YTgzLTkxMWYtNmU2N2NhYjZlOWJh}:1
+//key 可以带任意前缀, 但最后三段必须是 NOTIFY:{<base64(Key)>}:<count>, 兼容不带 hash tag 的旧 key
+func DecodeNotifyKey(src string) (*Entity, error) {
+	keys := strings.Split(src, RedisKeySep)
 	length := len(keys)
-	if length < 4 {
-		return nil,errKeyFormat
+	if length < 3 || keys[length-3] != NotifyKeyPrefix {
+		return nil, errKeyFormat
 	}
-	keyBytes, err := base64.StdEncoding.DecodeString(keys[length-2])
+	entity, err := parseEntity(keys[length-2], keys[length-1])
+	if nil != err {
+		return nil, err
+	}
+	entity.legacy = isLegacyTag(keys[length-2])
+	return entity, nil
+}
+
+//parseEntity 由 base64 编码的 key 与重试次数还原 Entity
+func parseEntity(encodedKey, encodedCount string) (*Entity, error) {
+	encodedKey = strings.TrimSuffix(strings.TrimPrefix(encodedKey, "{"), "}")
+	keyBytes, err := base64.StdEncoding.DecodeString(encodedKey)
 	if nil != err {
 		return nil, errKeyFormat
 	}
-	count, err := strconv.ParseInt(keys[length-1], 10, 32)
-	if err != nil {
+	count, err := strconv.ParseInt(encodedCount, 10, 32)
+	if err != nil || count < 0 {
 		return nil, errKeyFormat
 	}
 	en := &Entity{
@@ -218,36 +348,156 @@ func (n *notification) decode(src string) (*Entity, error) {
 }
 
 //fetchValue
-//"TEST:dev:order:NOTIFY_VALUE:ZmY3ZDg5NGYtZjcxNi00NzlhLTk1YWYtOWViZjExYWUzZTEx"
+//"TEST:dev:order:NOTIFY_VALUE:{ZmY3ZDg5NGYtZjcxNi00NzlhLTk1YWYtOWViZjExYWUzZTEx}"
 func (n *notification) fetchValue(entity *Entity) error {
-	key := fmt.Sprintf("%s:%s", n.prefix, entity.valueKey())
+	key := n.key(entity.valueKey())
 	value, err := n.cache.Get(key)
 	entity.Value = value
 	return err
 }
 
-//锁定通知防止多实例处理冲突
+//锁定通知防止多实例处理冲突, 锁在订阅持有期间定期续期
 func (n *notification) lock(p *Entity) (bool, error) {
 	//"${NOTIFY_PREFIX}:NOTIFY_LOCK:15ba4ad6-5923-4a9d-89c9-b35f33c60fa3"
-	setKey := fmt.Sprintf("%s:%s:%s", n.prefix, NotifyLockPrefix, p.notifyKey())
-	value := fmt.Sprintf("%s:%s", NotifyLockPrefix, n.node)
-	ret, err := n.cache.SetNX(setKey, []byte(value), n.policies.last().String())
+	setKey := n.lockKey(p)
+	token := fmt.Sprintf("%s:%s:%s", NotifyLockPrefix, n.node, uuid.New().String())
+	ret, err := n.cache.SetNXDuration(setKey, []byte(token), n.lockTTL)
 	if err != nil {
 		return false, err
 	}
 	if !ret{
 		return false, nil
 	}
-	rVal, err := n.cache.Get(setKey)
+	p.token = token
+	return true, nil
+}
+
+//解锁通知实例, 只删除当前节点持有的锁, 返回锁是否仍由当前节点持有
+func (n *notification) unlock(p *Entity) bool {
+	keys := []string{n.fullKey(NotifyLockPrefix + RedisKeySep + p.notifyKey())}
+	ret, err := unlockScript.Run(n.cache.NativeCmd(), keys, p.token).Result()
 	if err != nil {
-		return false, err
+		n.logger.Error("unlock entity", "entity", p, "err", err)
+		return false
+	}
+	return ret == int64(1)
+}
+
+//locked 通知锁是否仍由当前节点持有
+func (n *notification) locked(p *Entity) bool {
+	token, err := n.cache.Get(n.lockKey(p))
+	return nil == err && string(token) == p.token
+}
+
+//通知锁 key
+func (n *notification) lockKey(p *Entity) string {
+	return n.key(NotifyLockPrefix + RedisKeySep + p.notifyKey())
+}
+
+//key 返回不包含 RedisCli 前缀的 key, tagged 时使用 {prefix} 作为 hash tag,
+//集群模式下调度队列与所有通知的 value, 状态在同一个 slot
+func (n *notification) key(suffix string) string {
+	if n.tagged {
+		return companionKey(n.prefix, suffix)
 	}
+	return n.prefix + RedisKeySep + suffix
+}
 
-	return  value == string(rVal), nil
+//fullKey 返回包含 RedisCli 前缀的完整 key, 用于 lua 脚本与 keyspace 订阅
+func (n *notification) fullKey(suffix string) string {
+	return n.cache.KeyPrefix() + RedisKeySep + n.key(suffix)
+}
+
+//keyspaceSource 基于 keyspace expired 事件的通知来源
+type keyspaceSource struct {
+	n    *notification
+	psub *redis.PubSub
+}
+
+func (k *keyspaceSource) receive(stop <-chan struct{}) ([]*Entity, error) {
+	n := k.n
+	msg, err := k.psub.ReceiveTimeout(receiveTimeout)
+	if nil != err {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, nil
+		}
+		return nil, err
+	}
+	message, ok := msg.(*redis.Message)
+	if !ok || message.Payload != "expired" {
+		return nil, nil
+	}
+
+	entity, err := DecodeNotifyKey(message.Channel)
+	if nil != err {
+		n.logger.Error("decode message", "key", message.Channel, "err", err)
+		n.observer.Observe(n.prefix, EventDecodeFailed)
+		return nil, nil
+	}
+
+	locked, err := n.lock(entity)
+	if nil != err {
+		n.logger.Error("lock entity", "key", entity, "err", err)
+		return nil, nil
+	}
+	//locked by another process
+	if !locked {
+		n.observer.Observe(n.prefix, EventLockedByOther)
+		return nil, nil
+	}
+	if entity.legacy {
+		k.migrateLegacy(entity)
+		return nil, nil
+	}
+	return []*Entity{entity}, nil
+}
+
+//migrateLegacy 升级前写入的通知在加锁后迁移到带 hash tag 的 key 并立即重新触发, 不交给 handler.
+//旧的 value, 状态与锁不在同一个 slot, 无法在 ack 时原子地清理
+func (k *keyspaceSource) migrateLegacy(entity *Entity) {
+	n := k.n
+	if err := n.migrate(entity, n.clock.Now().Add(time.Millisecond)); err != nil {
+		n.logger.Error("migrate legacy entity", "entity", entity, "err", err)
+	}
+	n.unlock(entity)
+}
+
+//ack 只在锁仍由当前节点持有时原子地清理 value, 状态与锁, 锁已被其他节点持有时不修改通知
+func (k *keyspaceSource) ack(entity *Entity, requeued bool) {
+	//重新投递的通知保留锁直到过期, 防止其他节点重复处理同一事件
+	if requeued {
+		return
+	}
+	n := k.n
+	keys := []string{
+		n.fullKey(NotifyLockPrefix + RedisKeySep + entity.notifyKey()),
+		n.fullKey(entity.valueKey()),
+		n.fullKey(entity.stateKey()),
+	}
+	ret, err := finishLockScript.Run(n.cache.NativeCmd(), keys, entity.token, entity.count).Result()
+	if nil != err {
+		n.logger.Error("ack entity", "entity", entity, "err", err)
+		return
+	}
+	if ret != int64(1) {
+		n.logger.Warn("lock lost before ack", "entity", entity)
+	}
+}
+
+func (k *keyspaceSource) release(entity *Entity) {
+	k.n.unlock(entity)
+}
+
+//requeue 重新写入已过期的通知 key, 在 delay 之后再次产生 expired 事件
+func (k *keyspaceSource) requeue(entity *Entity, delay time.Duration) {
+	n := k.n
+	key := n.fullKey(entity.notifyKey())
+	if err := n.cache.NativeCmd().SetNX(key, "", delay).Err(); err != nil {
+		n.logger.Error("requeue entity", "entity", entity, "err", err)
+	}
+	n.unlock(entity)
 }
 
-//解锁通知实例
-func (n *notification) unlock(p *Entity) {
-	setKey := fmt.Sprintf("%s:%s:%s", n.prefix, NotifyLockPrefix, p.notifyKey())
-	n.cache.Del(setKey)
+func (k *keyspaceSource) close() error {
+	return k.psub.Close()
 }
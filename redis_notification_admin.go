@@ -0,0 +1,413 @@
+// inspect, cancel and reschedule pending notifications
+
+package redisplus
+
+import (
+	"errors"
+	"gopkg.in/redis.v5"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanCount 扫描通知相关 key 时单次 SCAN 的数量
+const scanCount = 100
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+//errScanStopped scanNodes 已找到需要的 key, 停止扫描
+var errScanStopped = errors.New("scan stopped")
+
+//rescheduleScript 通知在调度队列中且未被认领时修改触发时间, 并保证 value 与状态在新的触发时间之后仍然有效
+//KEYS[1] 调度队列 KEYS[2] 处理队列 KEYS[3] 状态 KEYS[4] value
+//ARGV[1] member ARGV[2] 触发时间(ms) ARGV[3] 保留时间(ms)
+var rescheduleScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[2], ARGV[1]) or not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], 'XX', ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[3], 'due', ARGV[2])
+redis.call('PEXPIRE', KEYS[3], ARGV[3])
+redis.call('PEXPIRE', KEYS[4], ARGV[3])
+return 1
+`)
+
+//keyspaceRescheduleScript 通知 key 仍然存在时修改过期时间, 并保证 value 与状态在新的触发时间之后仍然有效.
+//三个 key 带有相同的 hash tag, 集群模式下在同一个 slot
+//KEYS[1] 通知 KEYS[2] 状态 KEYS[3] value
+//ARGV[1] 触发时间(ms) ARGV[2] 保留时间(ms)
+var keyspaceRescheduleScript = redis.NewScript(`
+if redis.call('PEXPIREAT', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'due', ARGV[1])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+redis.call('PEXPIRE', KEYS[3], ARGV[2])
+return 1
+`)
+
+//cancelScript 通知仍在调度队列中时移除, 并删除 value 与状态, 已被认领的通知不修改
+//KEYS[1] 调度队列 KEYS[2] value KEYS[3] 状态 ARGV[1] member
+var cancelScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('DEL', KEYS[2], KEYS[3])
+return 1
+`)
+
+//keyspaceCancelScript 通知 key 仍然存在时删除, 并删除 value 与状态. 删除通知 key 不会产生 expired 事件,
+//已触发的通知不修改
+//KEYS[1] 通知 KEYS[2] value KEYS[3] 状态
+var keyspaceCancelScript = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('DEL', KEYS[2], KEYS[3])
+return 1
+`)
+
+// PendingNotification 等待触发的通知
+type PendingNotification struct {
+	Key   string
+	Value []byte
+	Count int64     //下一次触发时的重试次数
+	DueAt time.Time //下一次触发的时间
+}
+
+//pendingEntity 查找 key 当前等待触发的通知, 优先使用通知状态中的重试次数,
+//没有状态记录时扫描所有重试次数的通知 key
+func (n *notification) pendingEntity(key string) (*Entity, error) {
+	entity := &Entity{Key: key}
+	count, err := n.fetchCount(entity)
+	if nil == err {
+		entity.count = count
+		exists, err := n.cache.NativeCmd().Exists(n.fullKey(entity.notifyKey())).Result()
+		if nil != err {
+			return nil, err
+		}
+		if exists {
+			return entity, nil
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	//升级前写入的通知不带 hash tag
+	legacy := &Entity{Key: key, legacy: true}
+	for _, e := range []*Entity{entity, legacy} {
+		found, err := n.scanEntity(e)
+		if nil != err || found != nil {
+			return found, err
+		}
+	}
+	return nil, ErrNotificationNotFound
+}
+
+//scanEntity 扫描 entity 任意重试次数的通知 key, 集群模式下扫描所有 master 节点, 没有找到时返回 nil
+func (n *notification) scanEntity(entity *Entity) (*Entity, error) {
+	pattern := n.fullKey(strings.Join([]string{NotifyKeyPrefix, entity.tag(), "*"}, RedisKeySep))
+	var mu sync.Mutex
+	var found string
+	err := scanNodes(n.cache.NativeCmd(), pattern, func(keys []string) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if found == "" {
+			found = keys[0]
+		}
+		return errScanStopped
+	})
+	if found != "" {
+		return DecodeNotifyKey(found)
+	}
+	if nil != err {
+		return nil, err
+	}
+	return nil, nil
+}
+
+//pending 读取通知的 value 与触发时间
+func (n *notification) pending(entity *Entity, dueAt time.Time) (*PendingNotification, error) {
+	if err := n.fetchValue(entity); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return &PendingNotification{
+		Key:   entity.Key,
+		Value: entity.Value,
+		Count: entity.count,
+		DueAt: dueAt,
+	}, nil
+}
+
+func (n *notification) Get(key string) (*PendingNotification, error) {
+	entity, err := n.pendingEntity(key)
+	if nil != err {
+		return nil, err
+	}
+	ttl, err := n.cache.NativeCmd().PTTL(n.fullKey(entity.notifyKey())).Result()
+	if nil != err {
+		return nil, err
+	}
+	if ttl < 0 {
+		return nil, ErrNotificationNotFound
+	}
+	return n.pending(entity, n.clock.Now().Add(ttl))
+}
+
+func (n *notification) Cancel(key string) error {
+	entity, err := n.pendingEntity(key)
+	if nil != err {
+		return err
+	}
+	if entity.legacy {
+		return n.cancelLegacy(entity)
+	}
+	keys := []string{
+		n.fullKey(entity.notifyKey()),
+		n.fullKey(entity.valueKey()),
+		n.fullKey(entity.stateKey()),
+	}
+	ret, err := keyspaceCancelScript.Run(n.cache.NativeCmd(), keys).Result()
+	if nil != err {
+		return err
+	}
+	//已触发或已取消
+	if ret != int64(1) {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+//cancelLegacy 升级前写入的通知 key 与 value, 状态不在同一个 slot, 只有删除了通知 key 的调用方清理 value 与状态
+func (n *notification) cancelLegacy(entity *Entity) error {
+	deleted, err := n.cache.Del(n.key(entity.notifyKey()))
+	if nil != err {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotificationNotFound
+	}
+	n.finish(entity)
+	return nil
+}
+
+func (n *notification) Reschedule(key string, at time.Time) error {
+	entity, err := n.pendingEntity(key)
+	if nil != err {
+		return err
+	}
+	//过期时间已过时 redis 直接删除 key 而不产生 expired 事件, 至少保留 1ms
+	if min := n.clock.Now().Add(time.Millisecond); at.Before(min) {
+		at = min
+	}
+	if entity.legacy {
+		return n.migrate(entity, at)
+	}
+	keys := []string{
+		n.fullKey(entity.notifyKey()),
+		n.fullKey(entity.stateKey()),
+		n.fullKey(entity.valueKey()),
+	}
+	holding := n.holdingAfter(at.Sub(n.clock.Now()))
+	ret, err := keyspaceRescheduleScript.Run(n.cache.NativeCmd(), keys,
+		toMillis(at), int64(holding/time.Millisecond)).Result()
+	if nil != err {
+		return err
+	}
+	//已触发或已取消
+	if ret != int64(1) {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+//migrate 将升级前写入的通知按新的 key 在 at 重新投递, 旧的通知 key 与 value 在新的通知写入后删除
+func (n *notification) migrate(entity *Entity, at time.Time) error {
+	if err := n.fetchValue(entity); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	next := &Entity{count: entity.count, Key: entity.Key, Value: entity.Value}
+	if err := n.put(next, at.Sub(n.clock.Now())); err != nil {
+		return err
+	}
+	//删除通知 key 不会产生 expired 事件
+	if _, err := n.cache.Del(n.key(entity.notifyKey())); err != nil {
+		return err
+	}
+	n.finish(entity)
+	return nil
+}
+
+//pendingCursorShift keyspace 通知的 Pending cursor 高 16 位为节点序号, 低 48 位为该节点上的 SCAN cursor
+const pendingCursorShift = 48
+
+var errPendingCursor = errors.New("scan cursor exceeds 48 bits")
+
+//Pending 通知 key 分布在集群的所有 master 节点上, 按地址顺序逐个节点扫描, 每次调用只在一个节点上执行一次 SCAN.
+//集群拓扑变化后节点序号超出范围时视为结束
+func (n *notification) Pending(cursor uint64) ([]*PendingNotification, uint64, error) {
+	nodes, err := masterNodes(n.cache.NativeCmd())
+	if nil != err {
+		return nil, 0, err
+	}
+	index := int(cursor >> pendingCursorShift)
+	if index >= len(nodes) {
+		return nil, 0, nil
+	}
+	pattern := n.fullKey(NotifyKeyPrefix + RedisKeySep + "*")
+	keys, next, err := nodes[index].Scan(cursor&(1<<pendingCursorShift-1), pattern, scanCount).Result()
+	if nil != err {
+		return nil, 0, wrapError("scan", pattern, err)
+	}
+	if next >= 1<<pendingCursorShift {
+		return nil, 0, errPendingCursor
+	}
+	if next == 0 {
+		index++
+		if index == len(nodes) {
+			index = 0
+		}
+	}
+	var out []*PendingNotification
+	for _, key := range keys {
+		entity, err := DecodeNotifyKey(key)
+		if nil != err {
+			continue
+		}
+		ttl, err := n.cache.NativeCmd().PTTL(key).Result()
+		if nil != err {
+			return nil, 0, err
+		}
+		if ttl < 0 {
+			continue
+		}
+		p, err := n.pending(entity, n.clock.Now().Add(ttl))
+		if nil != err {
+			return nil, 0, err
+		}
+		out = append(out, p)
+	}
+	return out, uint64(index)<<pendingCursorShift | next, nil
+}
+
+func (n *scheduledNotification) pendingEntity(key string) (*Entity, time.Time, error) {
+	entity := &Entity{Key: key}
+	count, err := n.fetchCount(entity)
+	if nil == err {
+		entity.count = count
+		score, err := n.cache.NativeCmd().ZScore(n.fullKey(NotifySchedulePrefix), entity.member()).Result()
+		if nil == err {
+			return entity, fromMillis(score), nil
+		}
+		if err != redis.Nil {
+			return nil, time.Time{}, err
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, time.Time{}, err
+	}
+
+	pattern := entity.encodedKey() + RedisKeySep + "*"
+	var cursor uint64
+	for {
+		values, next, err := n.cache.NativeCmd().ZScan(n.fullKey(NotifySchedulePrefix), cursor, pattern, scanCount).Result()
+		if nil != err {
+			return nil, time.Time{}, err
+		}
+		if len(values) >= 2 {
+			entity, err := decodeMember(values[0])
+			if nil != err {
+				return nil, time.Time{}, err
+			}
+			score, err := strconv.ParseFloat(values[1], 64)
+			if nil != err {
+				return nil, time.Time{}, err
+			}
+			return entity, fromMillis(score), nil
+		}
+		if next == 0 {
+			return nil, time.Time{}, ErrNotificationNotFound
+		}
+		cursor = next
+	}
+}
+
+func (n *scheduledNotification) Get(key string) (*PendingNotification, error) {
+	entity, dueAt, err := n.pendingEntity(key)
+	if nil != err {
+		return nil, err
+	}
+	return n.pending(entity, dueAt)
+}
+
+func (n *scheduledNotification) Cancel(key string) error {
+	entity, _, err := n.pendingEntity(key)
+	if nil != err {
+		return err
+	}
+	keys := []string{
+		n.fullKey(NotifySchedulePrefix),
+		n.fullKey(entity.valueKey()),
+		n.fullKey(entity.stateKey()),
+	}
+	ret, err := cancelScript.Run(n.cache.NativeCmd(), keys, entity.member()).Result()
+	if nil != err {
+		return err
+	}
+	//已被认领或已取消
+	if ret != int64(1) {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (n *scheduledNotification) Reschedule(key string, at time.Time) error {
+	entity, _, err := n.pendingEntity(key)
+	if nil != err {
+		return err
+	}
+	keys := []string{
+		n.fullKey(NotifySchedulePrefix),
+		n.fullKey(NotifyProcessingPrefix),
+		n.fullKey(entity.stateKey()),
+		n.fullKey(entity.valueKey()),
+	}
+	holding := n.holdingAfter(at.Sub(n.clock.Now()))
+	ret, err := rescheduleScript.Run(n.cache.NativeCmd(), keys,
+		entity.member(), toMillis(at), int64(holding/time.Millisecond)).Result()
+	if nil != err {
+		return err
+	}
+	//已被认领或已取消
+	if ret != int64(1) {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (n *scheduledNotification) Pending(cursor uint64) ([]*PendingNotification, uint64, error) {
+	values, next, err := n.cache.NativeCmd().ZScan(n.fullKey(NotifySchedulePrefix), cursor, "", scanCount).Result()
+	if nil != err {
+		return nil, 0, err
+	}
+	var out []*PendingNotification
+	for i := 0; i+1 < len(values); i += 2 {
+		entity, err := decodeMember(values[i])
+		if nil != err {
+			continue
+		}
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if nil != err {
+			continue
+		}
+		p, err := n.pending(entity, fromMillis(score))
+		if nil != err {
+			return nil, 0, err
+		}
+		out = append(out, p)
+	}
+	return out, next, nil
+}
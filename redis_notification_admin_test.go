@@ -0,0 +1,171 @@
+package redisplus
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceAdmin(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	s, n := newTestKeyspace(t, WithClock(clock))
+	s.SetTime(clock.now)
+	n.PutNotification(&Entity{Key: "1", Value: []byte("a")})
+	n.PutNotification(&Entity{Key: "2", Value: []byte("b")})
+
+	p, err := n.Get("1")
+	if err != nil || p.Key != "1" || string(p.Value) != "a" || p.Count != 0 || !p.DueAt.Equal(clock.now.Add(time.Minute)) {
+		t.Fatal(p, err)
+	}
+	if _, err := n.Get("none"); err != ErrNotificationNotFound {
+		t.Fatal(err)
+	}
+
+	at := clock.now.Add(time.Hour)
+	if err := n.Reschedule("1", at); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := n.Get("1"); !p.DueAt.Equal(at) {
+		t.Fatal("rescheduled due", p.DueAt)
+	}
+	if due, err := n.fetchDue(&Entity{Key: "1"}); err != nil || !due.Equal(at) {
+		t.Fatal("state due", due, err)
+	}
+	if ttl := s.TTL(n.fullKey((&Entity{Key: "1"}).valueKey())); ttl < time.Hour {
+		t.Fatal("value expires before the rescheduled fire", ttl)
+	}
+
+	all, cursor, err := n.Pending(0)
+	if err != nil || cursor != 0 || len(all) != 2 {
+		t.Fatal(all, cursor, err)
+	}
+
+	if err := n.Cancel("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Get("1"); err != ErrNotificationNotFound {
+		t.Fatal(err)
+	}
+	if err := n.Cancel("1"); err != ErrNotificationNotFound {
+		t.Fatal(err)
+	}
+	if err := n.Reschedule("1", at); err != ErrNotificationNotFound {
+		t.Fatal(err)
+	}
+	if all, _, _ := n.Pending(0); len(all) != 1 || all[0].Key != "2" {
+		t.Fatal(all)
+	}
+
+	//查找之后通知已触发: 不删除 handler 将要读取的 value 与状态
+	fired := &Entity{Key: "2"}
+	s.Del(n.fullKey(fired.notifyKey()))
+	keys := []string{n.fullKey(fired.notifyKey()), n.fullKey(fired.valueKey()), n.fullKey(fired.stateKey())}
+	if ret, err := keyspaceCancelScript.Run(n.cache.NativeCmd(), keys).Result(); err != nil || ret != int64(0) {
+		t.Fatal("cancelled a fired notification", ret, err)
+	}
+	if !s.Exists(n.fullKey(fired.valueKey())) || !s.Exists(n.fullKey(fired.stateKey())) {
+		t.Fatal("cancel removed the value of a fired notification", s.Keys())
+	}
+}
+
+//TestKeyspacePendingScan Pending 按节点分页返回通知, 没有状态记录的通知通过扫描查找
+func TestKeyspacePendingScan(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	for i := 0; i < 2*scanCount+1; i++ {
+		n.PutNotification(&Entity{Key: strconv.Itoa(i), Value: []byte("v")})
+	}
+	seen := map[string]bool{}
+	var cursor uint64
+	for {
+		page, next, err := n.Pending(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range page {
+			seen[p.Key] = true
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+		if cursor>>pendingCursorShift != 0 {
+			t.Fatal("single node cursor has a node index", cursor)
+		}
+	}
+	if len(seen) != 2*scanCount+1 {
+		t.Fatal(len(seen))
+	}
+	//节点序号超出范围时结束
+	if all, cursor, err := n.Pending(1 << pendingCursorShift); err != nil || cursor != 0 || len(all) != 0 {
+		t.Fatal(all, cursor, err)
+	}
+
+	s.Del(n.fullKey((&Entity{Key: "7"}).stateKey()))
+	if p, err := n.Get("7"); err != nil || p.Key != "7" || p.Count != 0 {
+		t.Fatal(p, err)
+	}
+}
+
+func TestScheduledAdmin(t *testing.T) {
+	s, n, clock := newTestScheduled(t)
+	n.PutNotification(&Entity{Key: "1", Value: []byte("a")})
+	n.PutNotification(&Entity{Key: "2", Value: []byte("b")})
+
+	p, err := n.Get("1")
+	if err != nil || string(p.Value) != "a" || !p.DueAt.Equal(clock.now.Add(time.Minute)) {
+		t.Fatal(p, err)
+	}
+
+	at := clock.now.Add(time.Hour)
+	if err := n.Reschedule("1", at); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := n.Get("1"); !p.DueAt.Equal(at) {
+		t.Fatal("rescheduled due", p.DueAt)
+	}
+	if due, err := n.fetchDue(&Entity{Key: "1"}); err != nil || !due.Equal(at) {
+		t.Fatal("state due", due, err)
+	}
+	if ttl := s.TTL(n.fullKey((&Entity{Key: "1"}).stateKey())); ttl < time.Hour {
+		t.Fatal("state expires before the rescheduled fire", ttl)
+	}
+
+	all, cursor, err := n.Pending(0)
+	if err != nil || cursor != 0 || len(all) != 2 {
+		t.Fatal(all, cursor, err)
+	}
+
+	//已被认领的通知不能修改触发时间
+	clock.now = clock.now.Add(time.Minute)
+	if claimed, _ := n.claim(10); len(claimed) != 1 || claimed[0].Key != "2" {
+		t.Fatal(claimed)
+	}
+	if err := n.Reschedule("2", at); err != ErrNotificationNotFound {
+		t.Fatal("rescheduled a claimed notification", err)
+	}
+	if members, _ := s.ZMembers(n.fullKey(NotifySchedulePrefix)); len(members) != 1 {
+		t.Fatal("claimed notification was added back to the schedule", members)
+	}
+
+	if err := n.Cancel("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Get("1"); err != ErrNotificationNotFound {
+		t.Fatal(err)
+	}
+	if err := n.Cancel("1"); err != ErrNotificationNotFound {
+		t.Fatal(err)
+	}
+	if all, _, _ := n.Pending(0); len(all) != 0 {
+		t.Fatal(all)
+	}
+
+	//查找之后通知已被认领: 不删除 handler 将要读取的 value 与状态
+	claimed := &Entity{Key: "2"}
+	keys := []string{n.fullKey(NotifySchedulePrefix), n.fullKey(claimed.valueKey()), n.fullKey(claimed.stateKey())}
+	if ret, err := cancelScript.Run(n.cache.NativeCmd(), keys, claimed.member()).Result(); err != nil || ret != int64(0) {
+		t.Fatal("cancelled a claimed notification", ret, err)
+	}
+	if !s.Exists(n.fullKey(claimed.valueKey())) || !s.Exists(n.fullKey(claimed.stateKey())) {
+		t.Fatal("cancel removed the value of a claimed notification", s.Keys())
+	}
+}
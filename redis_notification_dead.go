@@ -0,0 +1,151 @@
+// dead letters of notifications which exhausted their retry policies
+
+package redisplus
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const NotifyDeadPrefix = "NOTIFY_DEAD"
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+//通知状态中记录的字段
+const (
+	stateCountField   = "count"   //当前重试次数
+	stateDueField     = "due"     //计划触发时间
+	stateAttemptField = "attempt" //每次处理的时间
+	stateErrorField   = "error"   //最后一次处理的错误
+)
+
+// DeadLetter 重试策略已用完的通知
+type DeadLetter struct {
+	Key       string      `json:"key"`
+	Value     []byte      `json:"value,omitempty"`
+	Count     int64       `json:"count"`                //已处理次数
+	LastError string      `json:"last_error,omitempty"` //最后一次处理的错误
+	Attempts  []time.Time `json:"attempts,omitempty"`   //每次处理的时间
+	DeadAt    time.Time   `json:"dead_at"`
+}
+
+//recordAttempt 在通知状态中记录本次处理时间与错误
+func (n *notification) recordAttempt(p *Entity, firedAt time.Time, err error) {
+	state := map[string][]byte{
+		stateAttemptField + RedisKeySep + strconv.FormatInt(p.count, 10): []byte(strconv.FormatInt(toMillis(firedAt), 10)),
+	}
+	if nil != err {
+		state[stateErrorField] = []byte(err.Error())
+	}
+	if err := n.cache.HMSet(n.key(p.stateKey()), state); err != nil {
+		n.logger.Error("record attempt", "entity", p, "err", err)
+	}
+}
+
+//bury 将重试策略已用完的通知移入死信
+func (n *notification) bury(p *Entity) error {
+	state, err := n.cache.HGetAll(n.key(p.stateKey()))
+	if nil != err {
+		return err
+	}
+	letter := &DeadLetter{
+		Key:       p.Key,
+		Value:     p.Value,
+		Count:     p.count + 1,
+		LastError: string(state[stateErrorField]),
+		DeadAt:    n.clock.Now(),
+	}
+	var attempts []int64
+	for field, value := range state {
+		if !strings.HasPrefix(field, stateAttemptField+RedisKeySep) {
+			continue
+		}
+		millis, err := strconv.ParseInt(string(value), 10, 64)
+		if nil != err {
+			continue
+		}
+		attempts = append(attempts, millis)
+	}
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i] < attempts[j] })
+	for _, millis := range attempts {
+		letter.Attempts = append(letter.Attempts, time.Unix(0, millis*int64(time.Millisecond)))
+	}
+
+	bs, err := json.Marshal(letter)
+	if nil != err {
+		return err
+	}
+	return n.cache.HMSet(n.deadKey(), map[string][]byte{p.encodedKey(): bs})
+}
+
+func (n *notification) deadKey() string {
+	return n.key(NotifyDeadPrefix)
+}
+
+func (n *notification) DeadLetters() ([]*DeadLetter, error) {
+	all, err := n.cache.HGetAll(n.deadKey())
+	if nil != err {
+		return nil, err
+	}
+	letters := make([]*DeadLetter, 0, len(all))
+	for field, bs := range all {
+		letter := &DeadLetter{}
+		if err := json.Unmarshal(bs, letter); err != nil {
+			n.logger.Error("decode dead letter", "field", field, "err", err)
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].DeadAt.Before(letters[j].DeadAt) })
+	return letters, nil
+}
+
+func (n *notification) DeadLetter(key string) (*DeadLetter, error) {
+	bs, err := n.cache.HGet(n.deadKey(), (&Entity{Key: key}).encodedKey())
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if nil != err {
+		return nil, err
+	}
+	letter := &DeadLetter{}
+	if err := json.Unmarshal(bs, letter); err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
+
+func (n *notification) Requeue(key string) error {
+	letter, err := n.DeadLetter(key)
+	if nil != err {
+		return err
+	}
+	entity := &Entity{Key: letter.Key, Value: letter.Value}
+	if err := n.schedule(entity, n.delay(entity, 0)); err != nil {
+		return err
+	}
+	_, err = n.Purge(key)
+	return err
+}
+
+func (n *notification) Purge(keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		count, err := n.cache.HLen(n.deadKey())
+		if nil != err {
+			return 0, err
+		}
+		if _, err := n.cache.Del(n.deadKey()); err != nil {
+			return 0, err
+		}
+		return count, nil
+	}
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, (&Entity{Key: key}).encodedKey())
+	}
+	return n.cache.HDel(n.deadKey(), fields...)
+}
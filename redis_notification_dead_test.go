@@ -0,0 +1,64 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	s, n := newTestKeyspace(t, WithPolicies(time.Minute, 2*time.Minute))
+	deliveries := make(chan *Delivery, 4)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		deliveries <- d
+		return Retry(errors.New("boom"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	n.PutNotification(entity)
+	for attempt := 0; attempt < 2; attempt++ {
+		next := &Entity{Key: "1", count: int64(attempt)}
+		waitFor(t, func() bool { return s.Exists(n.fullKey(next.notifyKey())) })
+		fireNotifications(s)
+		if d := receiveDelivery(t, deliveries); d.Attempt != attempt {
+			t.Fatal("attempt", d.Attempt, attempt)
+		}
+	}
+
+	var letter *DeadLetter
+	waitFor(t, func() bool {
+		letter, _ = n.DeadLetter("1")
+		return letter != nil
+	})
+	if letter.Key != "1" || string(letter.Value) != "v" || letter.Count != 2 || letter.LastError != "boom" || len(letter.Attempts) != 2 {
+		t.Fatal("dead letter", letter)
+	}
+	if letters, err := n.DeadLetters(); err != nil || len(letters) != 1 {
+		t.Fatal(letters, err)
+	}
+	if _, err := n.Get("1"); err != ErrNotificationNotFound {
+		t.Fatal("exhausted notification is still pending", err)
+	}
+
+	if err := n.Requeue("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.DeadLetter("1"); err != ErrDeadLetterNotFound {
+		t.Fatal(err)
+	}
+	pending, err := n.Get("1")
+	if err != nil || pending.Count != 0 || string(pending.Value) != "v" {
+		t.Fatal("requeued notification", pending, err)
+	}
+	if err := n.Requeue("1"); err != ErrDeadLetterNotFound {
+		t.Fatal(err)
+	}
+	if count, err := n.Purge(); err != nil || count != 0 {
+		t.Fatal(count, err)
+	}
+}
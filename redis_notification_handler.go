@@ -0,0 +1,95 @@
+// rich notification handler with delivery context and typed result
+
+package redisplus
+
+import (
+	"context"
+	"time"
+)
+
+// Delivery 一次通知触发的上下文
+type Delivery struct {
+	Entity      *Entity
+	Attempt     int       //第几次处理, 从 0 开始
+	Attempts    int       //重试策略允许的最大处理次数
+	ScheduledAt time.Time //计划触发时间, 旧版本写入的通知没有记录时为零值
+	FiredAt     time.Time //实际触发时间
+	Node        string    //处理通知的节点
+	Err         error     //读取 value 的错误
+
+	n *notification
+}
+
+// Last 是否为重试策略允许的最后一次处理
+func (d *Delivery) Last() bool {
+	return d.Attempt+1 >= d.Attempts
+}
+
+// ResultAction handler 处理结果
+type ResultAction int
+
+const (
+	// ActionDone 处理完成, 不再投递
+	ActionDone ResultAction = iota
+	// ActionRetry 按重试策略投递下一次通知
+	ActionRetry
+	// ActionRetryAfter 在 Result.Delay 之后投递下一次通知
+	ActionRetryAfter
+	// ActionDeadLetter 直接移入死信
+	ActionDeadLetter
+)
+
+func (a ResultAction) String() string {
+	switch a {
+	case ActionDone:
+		return "done"
+	case ActionRetry:
+		return "retry"
+	case ActionRetryAfter:
+		return "retry_after"
+	case ActionDeadLetter:
+		return "dead_letter"
+	}
+	return "unknown"
+}
+
+// Result DeliveryHandler 的返回值
+type Result struct {
+	Action ResultAction
+	Delay  time.Duration //ActionRetryAfter 的延迟时间
+	Err    error         //本次处理的错误, 记录到通知状态与死信中
+}
+
+// Done 处理完成
+func Done() Result {
+	return Result{Action: ActionDone}
+}
+
+// Retry 按重试策略重新投递
+func Retry(err error) Result {
+	return Result{Action: ActionRetry, Err: err}
+}
+
+// RetryAfter 在 delay 之后重新投递, delay 不足 1ms 时按 1ms 处理, 重试次数仍受重试策略长度限制
+func RetryAfter(delay time.Duration, err error) Result {
+	return Result{Action: ActionRetryAfter, Delay: delay, Err: err}
+}
+
+// ToDeadLetter 不再重试, 直接移入死信
+func ToDeadLetter(err error) Result {
+	return Result{Action: ActionDeadLetter, Err: err}
+}
+
+// DeliveryHandler 通知处理函数, ctx 在通知锁丢失或 Stop 超过 WithShutdownTimeout 时取消,
+// 锁丢失后的处理结果被丢弃. Stop 不会取消正在执行的 handler
+type DeliveryHandler func(ctx context.Context, d *Delivery) Result
+
+//adaptHandler 将 NotificationHandler 转换为 DeliveryHandler
+func adaptHandler(handler NotificationHandler) DeliveryHandler {
+	return func(ctx context.Context, d *Delivery) Result {
+		if handler(d.Entity, d.Err) {
+			return Retry(d.Err)
+		}
+		return Done()
+	}
+}
@@ -0,0 +1,71 @@
+// verify and enable notify-keyspace-events for keyspace notifications
+
+package redisplus
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/redis.v5"
+	"io"
+	"net"
+	"strings"
+)
+
+const notifyKeyspaceEvents = "notify-keyspace-events"
+
+var ErrKeyspaceEventsDisabled = errors.New("notify-keyspace-events must contain K and x (or A), " +
+	"enable it with CONFIG SET notify-keyspace-events Kx or WithEnableKeyspaceEvents")
+
+// WithEnableKeyspaceEvents Subscribe 检查到 notify-keyspace-events 缺少所需的标志时,
+// 通过 CONFIG SET 自动开启, 而不是返回 ErrKeyspaceEventsDisabled
+func WithEnableKeyspaceEvents() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.enableKeyspaceEvents = true
+	}
+}
+
+//keyspaceEventsEnabled 是否开启了 keyspace 通道的 expired 事件
+func keyspaceEventsEnabled(flags string) bool {
+	return strings.Contains(flags, "K") && (strings.Contains(flags, "x") || strings.Contains(flags, "A"))
+}
+
+//checkKeyspaceEvents 检查每个节点的 notify-keyspace-events,
+//节点禁用了 CONFIG 命令(如托管 redis)时只记录警告
+func (n *notification) checkKeyspaceEvents(enable bool) error {
+	check := func(client *redis.Client) error {
+		addr := client.String()
+		values, err := client.ConfigGet(notifyKeyspaceEvents).Result()
+		if nil != err {
+			if _, ok := err.(net.Error); ok || err == io.EOF {
+				return err
+			}
+			n.logger.Warn("CONFIG is disabled, cannot verify notify-keyspace-events", "node", addr, "err", err)
+			return nil
+		}
+		var flags string
+		if len(values) == 2 {
+			flags, _ = values[1].(string)
+		}
+		if keyspaceEventsEnabled(flags) {
+			return nil
+		}
+		if !enable {
+			return fmt.Errorf("node %s notify-keyspace-events %q: %w", addr, flags, ErrKeyspaceEventsDisabled)
+		}
+		if err := client.ConfigSet(notifyKeyspaceEvents, flags+"Kx").Err(); err != nil {
+			return fmt.Errorf("node %s enable notify-keyspace-events: %w", addr, err)
+		}
+		n.logger.Info("enabled notify-keyspace-events", "node", addr, "flags", flags+"Kx")
+		return nil
+	}
+
+	switch v := n.cache.NativeCmd().(type) {
+	case *redis.Client:
+		return check(v)
+	case *redis.ClusterClient:
+		return v.ForEachNode(check)
+	default:
+		n.logger.Warn("unknown redis client, cannot verify notify-keyspace-events")
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+//configStub miniredis 不支持 CONFIG, 注册一个只保存 notify-keyspace-events 的实现
+type configStub struct {
+	mu    sync.Mutex
+	flags string
+	sets  []string
+}
+
+func newConfigStub(t *testing.T, s *miniredis.Miniredis, flags string) *configStub {
+	c := &configStub{flags: flags}
+	err := s.Server().Register("CONFIG", func(peer *server.Peer, cmd string, args []string) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "GET") && args[1] == notifyKeyspaceEvents:
+			peer.WriteStrings([]string{notifyKeyspaceEvents, c.flags})
+		case len(args) == 3 && strings.EqualFold(args[0], "SET") && args[1] == notifyKeyspaceEvents:
+			c.flags = args[2]
+			c.sets = append(c.sets, args[2])
+			peer.WriteOK()
+		default:
+			peer.WriteError("ERR unsupported CONFIG " + strings.Join(args, " "))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *configStub) state() (string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flags, append([]string(nil), c.sets...)
+}
+
+func nopDelivery(ctx context.Context, d *Delivery) Result {
+	return Done()
+}
+
+func TestKeyspaceEventsMissingFlags(t *testing.T) {
+	for _, flags := range []string{"", "K", "Ex", "Eg"} {
+		s, n := newTestKeyspace(t)
+		config := newConfigStub(t, s, flags)
+		if _, err := n.SubscribeDelivery(nopDelivery); !errors.Is(err, ErrKeyspaceEventsDisabled) {
+			t.Fatalf("flags %q: %v", flags, err)
+		}
+		if _, sets := config.state(); len(sets) != 0 {
+			t.Fatal("CONFIG SET without WithEnableKeyspaceEvents", sets)
+		}
+	}
+	for _, flags := range []string{"Kx", "KA", "KEx", "AK"} {
+		s, n := newTestKeyspace(t)
+		newConfigStub(t, s, flags)
+		sub, err := n.SubscribeDelivery(nopDelivery)
+		if err != nil {
+			t.Fatalf("flags %q: %v", flags, err)
+		}
+		sub.Stop()
+	}
+}
+
+func TestKeyspaceEventsEnableOnSubscribe(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	config := newConfigStub(t, s, "Eg")
+	sub, err := n.SubscribeDelivery(nopDelivery, WithEnableKeyspaceEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Stop()
+	flags, sets := config.state()
+	if flags != "EgKx" || len(sets) != 1 || !keyspaceEventsEnabled(flags) {
+		t.Fatal(flags, sets)
+	}
+
+	//已经开启时不再 CONFIG SET
+	sub, err = n.SubscribeDelivery(nopDelivery, WithEnableKeyspaceEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Stop()
+	if _, sets := config.state(); len(sets) != 1 {
+		t.Fatal(sets)
+	}
+}
+
+func TestKeyspaceEventsConfigDisabled(t *testing.T) {
+	//miniredis 没有 CONFIG 命令, 与托管 redis 禁用 CONFIG 相同, 只记录警告
+	_, n := newTestKeyspace(t)
+	if err := n.checkKeyspaceEvents(false); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := n.SubscribeDelivery(nopDelivery, WithEnableKeyspaceEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Stop()
+}
@@ -0,0 +1,108 @@
+// short notification lock leases renewed while the subscription holds them
+
+package redisplus
+
+import (
+	"gopkg.in/redis.v5"
+	"time"
+)
+
+// defaultLockTTL 通知锁与处理租约的有效期, 持有期间每 1/3 有效期续期一次,
+// 节点崩溃后其他节点最多等待一个有效期即可接管
+const defaultLockTTL = time.Second * 30
+
+//unlockScript 锁的值与当前节点持有的值相同时才删除
+//KEYS[1] 锁 ARGV[1] 锁的值
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+//finishLockScript 锁的值与当前节点持有的值相同时删除 value, 状态与锁, 状态中的重试次数已变化
+//(通知已被重新写入)时只删除锁. 三个 key 带有相同的 hash tag,
+//其他节点的恢复扫描不会看到 value 与状态仍在而锁已释放的中间状态
+//KEYS[1] 锁 KEYS[2] value KEYS[3] 状态 ARGV[1] 锁的值 ARGV[2] 重试次数
+var finishLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local count = redis.call('HGET', KEYS[3], 'count')
+if not count or count == ARGV[2] then
+	redis.call('DEL', KEYS[2], KEYS[3])
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+//renewLockScript 锁的值与当前节点持有的值相同时才续期
+//KEYS[1] 锁 ARGV[1] 锁的值 ARGV[2] 有效期(ms)
+var renewLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+//renewLeaseScript 通知仍在处理队列中且租约 token 一致时才续期
+//KEYS[1] 处理队列 KEYS[2] 租约 token ARGV[1] member ARGV[2] 租约到期时间(ms) ARGV[3] 租约 token
+var renewLeaseScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) and redis.call('HGET', KEYS[2], ARGV[1]) == ARGV[3] then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+func (k *keyspaceSource) renew(entity *Entity) (bool, error) {
+	n := k.n
+	keys := []string{n.fullKey(NotifyLockPrefix + RedisKeySep + entity.notifyKey())}
+	ret, err := renewLockScript.Run(n.cache.NativeCmd(), keys, entity.token, int64(n.lockTTL/time.Millisecond)).Result()
+	return ret == int64(1), err
+}
+
+func (s *scheduleSource) renew(entity *Entity) (bool, error) {
+	n := s.n
+	keys := []string{n.fullKey(NotifyProcessingPrefix), n.fullKey(NotifyLeasePrefix)}
+	ret, err := renewLeaseScript.Run(n.cache.NativeCmd(), keys,
+		entity.member(), toMillis(n.clock.Now().Add(n.lockTTL)), entity.token).Result()
+	return ret == int64(1), err
+}
+
+//renewLoop 定期为本订阅持有的通知续期, 锁已丢失时取消对应 handler 的 ctx.
+//Stop 之后继续续期, 直到处理中的 handler 全部结束
+func (s *subscription) renewLoop() {
+	defer s.renewer.Done()
+	ticker := time.NewTicker(s.n.lockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.renew()
+		}
+	}
+}
+
+func (s *subscription) renew() {
+	s.mu.Lock()
+	held := make([]*Entity, 0, len(s.locks))
+	for _, h := range s.locks {
+		held = append(held, h.entity)
+	}
+	s.mu.Unlock()
+
+	for _, entity := range held {
+		ok, err := s.source.renew(entity)
+		if nil != err {
+			s.n.logger.Error("renew lock", "entity", entity, "err", err)
+			continue
+		}
+		if !ok {
+			s.n.logger.Warn("lock lost", "entity", entity)
+			s.lose(entity)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package redisplus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceLease(t *testing.T) {
+	s, n := newTestKeyspace(t, WithLockTTL(10*time.Second))
+	source := &keyspaceSource{n: n}
+	entity := &Entity{Key: "1"}
+	if ok, err := n.lock(entity); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	lock := n.fullKey(NotifyLockPrefix + RedisKeySep + entity.notifyKey())
+	if ok, _ := n.lock(&Entity{Key: "1"}); ok {
+		t.Fatal("locked twice")
+	}
+
+	s.FastForward(5 * time.Second)
+	if ok, err := source.renew(entity); err != nil || !ok || s.TTL(lock) != 10*time.Second {
+		t.Fatal("renew", ok, err, s.TTL(lock))
+	}
+
+	//锁过期后被其他节点持有
+	s.FastForward(11 * time.Second)
+	other := &Entity{Key: "1"}
+	if ok, _ := n.lock(other); !ok {
+		t.Fatal("expired lock was not taken over")
+	}
+	if ok, err := source.renew(entity); err != nil || ok {
+		t.Fatal("renewed a lost lock", ok, err)
+	}
+	n.unlock(entity)
+	if value, _ := s.Get(lock); value != other.token {
+		t.Fatal("unlock with a stale token removed the lock of another node", value)
+	}
+	n.unlock(other)
+	if s.Exists(lock) {
+		t.Fatal("lock was not released")
+	}
+}
+
+func TestScheduledLease(t *testing.T) {
+	s, n, clock := newTestScheduled(t)
+	source := &scheduleSource{n: n, batchSize: 10}
+	n.PutNotification(&Entity{Key: "1", Value: []byte("v")})
+	clock.now = clock.now.Add(time.Minute)
+	claimed, _ := n.claim(10)
+	processing := n.fullKey(NotifyProcessingPrefix)
+
+	clock.now = clock.now.Add(5 * time.Second)
+	if ok, err := source.renew(claimed[0]); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if score, _ := s.ZScore(processing, claimed[0].member()); score != float64(toMillis(clock.now.Add(10*time.Second))) {
+		t.Fatal("lease was not renewed from the notification clock", score)
+	}
+
+	//租约过期后被其他节点认领并处理完成
+	clock.now = clock.now.Add(11 * time.Second)
+	reclaimed, _ := n.claim(10)
+	if len(reclaimed) != 1 {
+		t.Fatal(reclaimed)
+	}
+	source.ack(reclaimed[0], false)
+	if ok, err := source.renew(claimed[0]); err != nil || ok {
+		t.Fatal("renewed a lost lease", ok, err)
+	}
+}
+
+//TestScheduledLeaseRace 两个节点竞争同一个 member, 租约被接管后原持有者不能续期, 结束或释放通知
+func TestScheduledLeaseRace(t *testing.T) {
+	s, n, clock := newTestScheduled(t)
+	source := &scheduleSource{n: n, batchSize: 10}
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	n.PutNotification(entity)
+	clock.now = clock.now.Add(time.Minute)
+	first, _ := n.claim(10)
+
+	//租约过期后由另一个节点的恢复扫描接管
+	clock.now = clock.now.Add(11 * time.Second)
+	second, err := source.sweep()
+	if err != nil || len(second) != 1 || second[0].member() != first[0].member() || second[0].token == first[0].token {
+		t.Fatal(second, err)
+	}
+	if ok, err := source.renew(first[0]); err != nil || ok {
+		t.Fatal("stale holder renewed the lease", ok, err)
+	}
+	source.ack(first[0], false)
+	source.release(first[0])
+	processing := n.fullKey(NotifyProcessingPrefix)
+	if _, err := s.ZScore(processing, first[0].member()); err != nil {
+		t.Fatal("stale holder removed the lease of the new owner", err)
+	}
+	if !s.Exists(n.fullKey(entity.valueKey())) || !s.Exists(n.fullKey(entity.stateKey())) {
+		t.Fatal("stale holder finished the notification", s.Keys())
+	}
+	if ok, err := source.renew(second[0]); err != nil || !ok {
+		t.Fatal("new owner cannot renew", ok, err)
+	}
+
+	source.ack(second[0], false)
+	if s.Exists(n.fullKey(entity.valueKey())) || s.Exists(processing) || s.Exists(n.fullKey(NotifyLeasePrefix)) {
+		t.Fatal("new owner did not finish the notification", s.Keys())
+	}
+}
+
+func TestKeyspaceStaleAck(t *testing.T) {
+	s, n := newTestKeyspace(t, WithLockTTL(10*time.Second))
+	source := &keyspaceSource{n: n}
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	n.PutNotification(entity)
+	stale := &Entity{Key: "1"}
+	n.lock(stale)
+
+	s.FastForward(11 * time.Second)
+	other := &Entity{Key: "1"}
+	if ok, _ := n.lock(other); !ok {
+		t.Fatal("expired lock was not taken over")
+	}
+	source.ack(stale, false)
+	if !s.Exists(n.fullKey(entity.valueKey())) || !s.Exists(n.fullKey(entity.stateKey())) {
+		t.Fatal("stale holder finished the notification", s.Keys())
+	}
+	source.ack(other, false)
+	if s.Exists(n.fullKey(entity.valueKey())) || s.Exists(n.fullKey(entity.stateKey())) ||
+		s.Exists(n.fullKey(NotifyLockPrefix+RedisKeySep+other.notifyKey())) {
+		t.Fatal("owner did not finish the notification", s.Keys())
+	}
+	//value, 状态与锁同时删除, 恢复扫描不会重新投递已完成的通知
+	if recovered, err := source.sweep(); err != nil || len(recovered) != 0 {
+		t.Fatal("finished notification was recovered", recovered, err)
+	}
+}
+
+func TestLostLockCancelsHandler(t *testing.T) {
+	s, n := newTestKeyspace(t, WithLockTTL(time.Second))
+	cancelled := make(chan error, 1)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		//其他节点在锁过期后接管
+		s.Set(n.fullKey(NotifyLockPrefix+RedisKeySep+d.Entity.notifyKey()), "other")
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return Done()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	n.PutNotification(entity)
+	waitFor(t, func() bool { return s.PubSubNumPat() > 0 })
+	fireNotifications(s)
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("handler ctx was not cancelled after the lock was lost")
+	}
+	waitFor(t, func() bool { return sub.Stats().Processed == 1 })
+	if !s.Exists(n.fullKey(entity.valueKey())) {
+		t.Fatal("result of a lost delivery was applied", s.Keys())
+	}
+	if value, _ := s.Get(n.fullKey(NotifyLockPrefix + RedisKeySep + entity.notifyKey())); value != "other" {
+		t.Fatal("lock of the new owner was removed", value)
+	}
+}
@@ -0,0 +1,208 @@
+// metrics and tracing hooks for notifications
+
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errObserverNotNil = errors.New("observer must be not null")
+
+// NotificationEvent 通知生命周期中的事件
+type NotificationEvent string
+
+const (
+	EventScheduled     NotificationEvent = "scheduled"       //写入通知
+	EventFired         NotificationEvent = "fired"           //通知到期交给 handler
+	EventLockedByOther NotificationEvent = "locked_by_other" //通知已被其他节点锁定
+	EventRetried       NotificationEvent = "retried"         //投递下一次重试
+	EventExhausted     NotificationEvent = "exhausted"       //重试策略已用完, 移入死信
+	EventDeadLettered  NotificationEvent = "dead_lettered"   //handler 要求直接移入死信
+	EventDecodeFailed  NotificationEvent = "decode_failed"   //通知 key 或 value 解码失败
+)
+
+// Observer 通知的指标与链路追踪钩子, 实现需要并发安全
+type Observer interface {
+	// Observe 记录通知事件
+	Observe(prefix string, event NotificationEvent)
+	// ObserveHandler 记录 handler 的执行时间与结果
+	ObserveHandler(prefix string, elapsed time.Duration, action ResultAction)
+	// StartSpan 在 handler 执行前开始一个 span, 返回的 ctx 传给 handler
+	StartSpan(ctx context.Context, d *Delivery) (context.Context, Span)
+}
+
+// Span handler 执行的 span
+type Span interface {
+	SetError(err error)
+	End()
+}
+
+// WithObserver 设置通知的 Observer
+func WithObserver(observer Observer) NotificationOption {
+	return func(n *notification) error {
+		if nil == observer {
+			return errObserverNotNil
+		}
+		n.observer = observer
+		return nil
+	}
+}
+
+type noopObserver struct{}
+
+func (noopObserver) Observe(string, NotificationEvent) {}
+
+func (noopObserver) ObserveHandler(string, time.Duration, ResultAction) {}
+
+func (noopObserver) StartSpan(ctx context.Context, d *Delivery) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetError(error) {}
+
+func (noopSpan) End() {}
+
+// DefaultLatencyBuckets handler 执行时间直方图的默认分桶(秒)
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsObserver 以 Prometheus 文本格式输出事件计数与 handler 执行时间直方图,
+// 可直接注册为 /metrics 的 http.Handler. 不记录 span
+type MetricsObserver struct {
+	noopObserver
+	buckets []float64
+
+	mu         sync.Mutex
+	events     map[eventLabels]uint64
+	histograms map[handlerLabels]*histogram
+}
+
+type eventLabels struct {
+	prefix string
+	event  NotificationEvent
+}
+
+type handlerLabels struct {
+	prefix string
+	action ResultAction
+}
+
+type histogram struct {
+	counts []uint64 //与 buckets 对应的累计数量
+	count  uint64
+	sum    float64
+}
+
+// NewMetricsObserver 创建 MetricsObserver, 不指定 buckets 时使用 DefaultLatencyBuckets
+func NewMetricsObserver(buckets ...float64) *MetricsObserver {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &MetricsObserver{
+		buckets:    sorted,
+		events:     make(map[eventLabels]uint64),
+		histograms: make(map[handlerLabels]*histogram),
+	}
+}
+
+func (m *MetricsObserver) Observe(prefix string, event NotificationEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[eventLabels{prefix, event}]++
+}
+
+func (m *MetricsObserver) ObserveHandler(prefix string, elapsed time.Duration, action ResultAction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels := handlerLabels{prefix, action}
+	h, ok := m.histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.histograms[labels] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出所有指标
+func (m *MetricsObserver) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP redisplus_notification_events_total Notification lifecycle events.\n")
+	b.WriteString("# TYPE redisplus_notification_events_total counter\n")
+	events := make([]eventLabels, 0, len(m.events))
+	for labels := range m.events {
+		events = append(events, labels)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].prefix != events[j].prefix {
+			return events[i].prefix < events[j].prefix
+		}
+		return events[i].event < events[j].event
+	})
+	for _, labels := range events {
+		fmt.Fprintf(&b, "redisplus_notification_events_total{prefix=%s,event=%s} %d\n",
+			quoteLabel(labels.prefix), quoteLabel(string(labels.event)), m.events[labels])
+	}
+
+	b.WriteString("# HELP redisplus_notification_handler_duration_seconds Notification handler latency.\n")
+	b.WriteString("# TYPE redisplus_notification_handler_duration_seconds histogram\n")
+	handlers := make([]handlerLabels, 0, len(m.histograms))
+	for labels := range m.histograms {
+		handlers = append(handlers, labels)
+	}
+	sort.Slice(handlers, func(i, j int) bool {
+		if handlers[i].prefix != handlers[j].prefix {
+			return handlers[i].prefix < handlers[j].prefix
+		}
+		return handlers[i].action < handlers[j].action
+	})
+	for _, labels := range handlers {
+		h := m.histograms[labels]
+		base := fmt.Sprintf("prefix=%s,action=%s", quoteLabel(labels.prefix), quoteLabel(labels.action.String()))
+		for i, bound := range m.buckets {
+			fmt.Fprintf(&b, "redisplus_notification_handler_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				base, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(&b, "redisplus_notification_handler_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", base, h.count)
+		fmt.Fprintf(&b, "redisplus_notification_handler_duration_seconds_sum{%s} %s\n", base, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "redisplus_notification_handler_duration_seconds_count{%s} %d\n", base, h.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *MetricsObserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WritePrometheus(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,51 @@
+package redisplus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsObserverPrometheus(t *testing.T) {
+	m := NewMetricsObserver(1, .5)
+	m.Observe("order", EventFired)
+	m.Observe("order", EventFired)
+	m.Observe("order", EventDecodeFailed)
+	m.Observe("a\"b\\c\nd", EventScheduled)
+	m.ObserveHandler("order", 250*time.Millisecond, ActionDone)
+	m.ObserveHandler("order", 2*time.Second, ActionDone)
+	m.ObserveHandler("order", 750*time.Millisecond, ActionRetry)
+
+	want := `# HELP redisplus_notification_events_total Notification lifecycle events.
+# TYPE redisplus_notification_events_total counter
+redisplus_notification_events_total{prefix="a\"b\\c\nd",event="scheduled"} 1
+redisplus_notification_events_total{prefix="order",event="decode_failed"} 1
+redisplus_notification_events_total{prefix="order",event="fired"} 2
+# HELP redisplus_notification_handler_duration_seconds Notification handler latency.
+# TYPE redisplus_notification_handler_duration_seconds histogram
+redisplus_notification_handler_duration_seconds_bucket{prefix="order",action="done",le="0.5"} 1
+redisplus_notification_handler_duration_seconds_bucket{prefix="order",action="done",le="1"} 1
+redisplus_notification_handler_duration_seconds_bucket{prefix="order",action="done",le="+Inf"} 2
+redisplus_notification_handler_duration_seconds_sum{prefix="order",action="done"} 2.25
+redisplus_notification_handler_duration_seconds_count{prefix="order",action="done"} 2
+redisplus_notification_handler_duration_seconds_bucket{prefix="order",action="retry",le="0.5"} 0
+redisplus_notification_handler_duration_seconds_bucket{prefix="order",action="retry",le="1"} 1
+redisplus_notification_handler_duration_seconds_bucket{prefix="order",action="retry",le="+Inf"} 1
+redisplus_notification_handler_duration_seconds_sum{prefix="order",action="retry"} 0.75
+redisplus_notification_handler_duration_seconds_count{prefix="order",action="retry"} 1
+`
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Body.String() != want || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal(rec.Header(), rec.Body.String())
+	}
+}
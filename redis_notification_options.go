@@ -0,0 +1,145 @@
+// functional options for NewNotification
+
+package redisplus
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultValueHolding value 与状态在最后一次触发之后的保留时间
+const defaultValueHolding = time.Minute * 5
+
+// minLockTTL 通知锁有效期的最小值, 续期间隔为有效期的 1/3
+const minLockTTL = time.Second
+
+var errPoliciesEmpty = errors.New("policies must be not empty")
+var errLoggerNotNil = errors.New("logger must be not null")
+var errNodeNotNil = errors.New("node must be not null")
+var errClockNotNil = errors.New("clock must be not null")
+var errLockTTL = errors.New("lock ttl must be at least 1s")
+var errValueHolding = errors.New("value holding must be positive")
+var errWorkers = errors.New("workers must be positive")
+
+// NotificationOption 创建通知的可选配置
+type NotificationOption func(n *notification) error
+
+// Clock 通知使用的时钟, 用于测试中控制时间
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithPolicies 使用固定的延迟序列作为重试策略, 序列必须升序
+func WithPolicies(delays ...time.Duration) NotificationOption {
+	return WithRetryPolicy(Policies(delays...))
+}
+
+// WithRetryPolicy 使用 ExponentialPolicy 等构造的重试策略
+func WithRetryPolicy(policy RetryPolicy) NotificationOption {
+	return func(n *notification) error {
+		if 0 == len(policy.delays) {
+			return errPoliciesEmpty
+		}
+		n.policies = policy.delays
+		n.retry = policy
+		return nil
+	}
+}
+
+// WithLogger 设置日志, 默认不输出日志
+func WithLogger(logger Logger) NotificationOption {
+	return func(n *notification) error {
+		if nil == logger {
+			return errLoggerNotNil
+		}
+		n.logger = logger
+		return nil
+	}
+}
+
+// WithNodeID 设置节点标识, 默认为本机 IP 与进程号
+func WithNodeID(node string) NotificationOption {
+	return func(n *notification) error {
+		if "" == node {
+			return errNodeNotNil
+		}
+		n.node = node
+		return nil
+	}
+}
+
+// WithLockTTL 设置通知锁与处理租约的有效期, 默认 30s
+func WithLockTTL(ttl time.Duration) NotificationOption {
+	return func(n *notification) error {
+		if ttl < minLockTTL {
+			return errLockTTL
+		}
+		n.lockTTL = ttl
+		return nil
+	}
+}
+
+// WithValueHolding 设置 value 在最后一次触发之后的保留时间, 默认 5m.
+// 保留时间为 0 时 value 可能与最后一次触发同时过期, 必须大于 0
+func WithValueHolding(holding time.Duration) NotificationOption {
+	return func(n *notification) error {
+		if holding <= 0 {
+			return errValueHolding
+		}
+		n.holding = holding
+		return nil
+	}
+}
+
+// WithClock 设置时钟, 默认使用系统时间
+func WithClock(clock Clock) NotificationOption {
+	return func(n *notification) error {
+		if nil == clock {
+			return errClockNotNil
+		}
+		n.clock = clock
+		return nil
+	}
+}
+
+// WithWorkerCount 设置订阅默认的 worker 数量, Subscribe 时可以通过 WithWorkers 覆盖
+func WithWorkerCount(workers int) NotificationOption {
+	return func(n *notification) error {
+		if workers <= 0 {
+			return errWorkers
+		}
+		n.workers = workers
+		return nil
+	}
+}
+
+//nopLogger 不输出任何日志的 Logger
+type nopLogger struct{}
+
+func (nopLogger) Trace(msg string, args ...interface{}) {}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+
+func (nopLogger) Info(msg string, args ...interface{}) {}
+
+func (nopLogger) Warn(msg string, args ...interface{}) {}
+
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+func (nopLogger) IsTrace() bool { return false }
+
+func (nopLogger) IsDebug() bool { return false }
+
+func (nopLogger) IsInfo() bool { return false }
+
+func (nopLogger) IsWarn() bool { return false }
+
+func (nopLogger) IsError() bool { return false }
+
+func (nopLogger) Name() string { return "nop" }
@@ -0,0 +1,71 @@
+package redisplus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNotificationOptions(t *testing.T) {
+	_, view := newTestView(t)
+	cases := []struct {
+		name string
+		opt  NotificationOption
+		want error
+	}{
+		{"holding zero", WithValueHolding(0), errValueHolding},
+		{"holding negative", WithValueHolding(-time.Second), errValueHolding},
+		{"holding", WithValueHolding(time.Second), nil},
+		{"lock ttl below minimum", WithLockTTL(minLockTTL - time.Millisecond), errLockTTL},
+		{"lock ttl", WithLockTTL(minLockTTL), nil},
+		{"policies empty", WithPolicies(), errPoliciesEmpty},
+		{"retry policy empty", WithRetryPolicy(ExponentialPolicy(time.Second, time.Minute, 0)), errPoliciesEmpty},
+		{"logger nil", WithLogger(nil), errLoggerNotNil},
+		{"node empty", WithNodeID(""), errNodeNotNil},
+		{"clock nil", WithClock(nil), errClockNotNil},
+		{"workers zero", WithWorkerCount(0), errWorkers},
+		{"workers", WithWorkerCount(2), nil},
+	}
+	for _, c := range cases {
+		if _, err := NewNotification("order", view, c.opt); err != c.want {
+			t.Fatalf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	if _, err := NewNotification("order", view, WithPolicies(time.Minute, time.Second)); err == nil {
+		t.Fatal("descending policies")
+	}
+	if _, err := NewNotification("", view); err != errPrefixNotNil {
+		t.Fatal(err)
+	}
+	if _, err := NewNotification("order", nil); err != errRedisNotNil {
+		t.Fatal(err)
+	}
+	n, err := newNotification("order", view, WithValueHolding(time.Minute), WithLockTTL(time.Minute), WithPolicies(time.Second, time.Hour))
+	if err != nil || n.holding != time.Minute || n.lockTTL != time.Minute || n.policies.last() != time.Hour {
+		t.Fatal(n, err)
+	}
+}
+
+func TestWorkerCountDefault(t *testing.T) {
+	_, n, _ := newTestScheduled(t, WithWorkerCount(3))
+	handler := func(ctx context.Context, d *Delivery) Result { return Done() }
+	for _, c := range []struct {
+		opts []SubscribeOption
+		want int
+	}{
+		{nil, 3},
+		{[]SubscribeOption{WithWorkers(2)}, 2},
+		{[]SubscribeOption{WithWorkers(0)}, 3},
+	} {
+		sub, err := n.SubscribeDelivery(handler, c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		workers := sub.Stats().Workers
+		sub.Stop()
+		if workers != c.want {
+			t.Fatalf("workers %d, want %d", workers, c.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// idempotent notification puts
+
+package redisplus
+
+import (
+	"errors"
+	"gopkg.in/redis.v5"
+	"strconv"
+	"time"
+)
+
+// PutMode PutNotificationMode 的写入方式
+type PutMode int
+
+const (
+	// PutIfAbsent key 已有等待触发的通知时不写入
+	PutIfAbsent PutMode = iota
+	// 以下写入方式在 key 的通知正在由 handler 处理时都不写入并返回 false,
+	// 处理结果决定通知是否结束或重试, 写入新的通知会产生重复的触发
+	// PutReplace 取消 key 等待触发的通知, 重新写入
+	PutReplace
+	// PutExtend key 已有等待触发的通知时保留其重试次数, 将触发时间推迟到 delay 之后,
+	// 已晚于该时间时不变; 没有等待触发的通知时写入
+	PutExtend
+)
+
+// putAttempts 写入期间通知状态被并发修改时的最大尝试次数
+const putAttempts = 3
+
+var errPutMode = errors.New("unknown put mode")
+var errPutConflict = errors.New("notification state changed concurrently")
+
+func (m PutMode) String() string {
+	switch m {
+	case PutIfAbsent:
+		return "insert"
+	case PutReplace:
+		return "replace"
+	case PutExtend:
+		return "extend"
+	}
+	return "unknown"
+}
+
+//upsertKeyspaceScript 原子地写入 keyspace 通知, 状态中的重试次数与 ARGV[2] 不一致时返回 -1,
+//状态中记录的通知 key 已过期但锁仍被持有时通知正在处理, 不写入
+//KEYS[1] 状态 KEYS[2] value KEYS[3] 新的通知 key KEYS[4] 状态中记录的通知 key KEYS[5] KEYS[4] 的锁
+//ARGV[1] 写入方式 ARGV[2] 状态中的重试次数, 没有状态时为空 ARGV[3] 重试次数 ARGV[4] 延迟(ms)
+//ARGV[5] 触发时间(ms) ARGV[6] 保留时间(ms) ARGV[7] value
+var upsertKeyspaceScript = redis.NewScript(`
+local old = redis.call('HGET', KEYS[1], 'count')
+if (old or '') ~= ARGV[2] then
+	return -1
+end
+if old and redis.call('EXISTS', KEYS[4]) == 0 and redis.call('EXISTS', KEYS[5]) == 1 then
+	return 0
+end
+if old and redis.call('EXISTS', KEYS[4]) == 1 then
+	if ARGV[1] == 'insert' then
+		return 0
+	end
+	if ARGV[1] == 'extend' then
+		if redis.call('PTTL', KEYS[4]) < tonumber(ARGV[4]) then
+			redis.call('PEXPIRE', KEYS[4], ARGV[4])
+			redis.call('HSET', KEYS[1], 'due', ARGV[5])
+		end
+		redis.call('SET', KEYS[2], ARGV[7], 'PX', ARGV[6])
+		redis.call('PEXPIRE', KEYS[1], ARGV[6])
+		return 1
+	end
+	redis.call('DEL', KEYS[4])
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[3], '', 'PX', ARGV[4])
+redis.call('SET', KEYS[2], ARGV[7], 'PX', ARGV[6])
+redis.call('HMSET', KEYS[1], 'count', ARGV[3], 'due', ARGV[5])
+redis.call('PEXPIRE', KEYS[1], ARGV[6])
+return 1
+`)
+
+//upsertScheduleScript 原子地写入 sorted set 通知, 所有 key 使用 {prefix} 作为 hash tag,
+//状态中记录的 member 在处理队列中时通知正在处理, 不写入
+//KEYS[1] 状态 KEYS[2] value KEYS[3] 调度队列 KEYS[4] 处理队列
+//ARGV[1] 写入方式 ARGV[2] base64(key) ARGV[3] 重试次数
+//ARGV[4] 触发时间(ms) ARGV[5] 保留时间(ms) ARGV[6] value
+var upsertScheduleScript = redis.NewScript(`
+local old = redis.call('HGET', KEYS[1], 'count')
+if old then
+	local member = ARGV[2] .. ':' .. old
+	if redis.call('ZSCORE', KEYS[4], member) then
+		return 0
+	end
+	local score = redis.call('ZSCORE', KEYS[3], member)
+	if score then
+		if ARGV[1] == 'insert' then
+			return 0
+		end
+		if ARGV[1] == 'extend' then
+			if tonumber(score) < tonumber(ARGV[4]) then
+				redis.call('ZADD', KEYS[3], ARGV[4], member)
+				redis.call('HSET', KEYS[1], 'due', ARGV[4])
+			end
+			redis.call('SET', KEYS[2], ARGV[6], 'PX', ARGV[5])
+			redis.call('PEXPIRE', KEYS[1], ARGV[5])
+			return 1
+		end
+		redis.call('ZREM', KEYS[3], member)
+	end
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], ARGV[6], 'PX', ARGV[5])
+redis.call('HMSET', KEYS[1], 'count', ARGV[3], 'due', ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+redis.call('ZADD', KEYS[3], ARGV[4], ARGV[2] .. ':' .. ARGV[3])
+return 1
+`)
+
+func checkPutMode(mode PutMode) error {
+	if mode < PutIfAbsent || mode > PutExtend {
+		return errPutMode
+	}
+	return nil
+}
+
+//PutNotificationMode 通知 key 随重试次数变化, 先读取状态中的重试次数, 将对应的通知 key 传给脚本,
+//脚本执行前状态已变化时重新读取
+func (n *notification) PutNotificationMode(p *Entity, mode PutMode) (bool, error) {
+	if err := checkPutMode(mode); err != nil {
+		return false, err
+	}
+	delay := n.delay(p, p.count)
+	for i := 0; i < putAttempts; i++ {
+		old, oldKey := "", p.notifyKey()
+		count, err := n.fetchCount(p)
+		if nil == err {
+			old = strconv.FormatInt(count, 10)
+			oldKey = (&Entity{Key: p.Key, count: count}).notifyKey()
+		} else if !errors.Is(err, ErrNotFound) {
+			return false, err
+		}
+		keys := []string{
+			n.fullKey(p.stateKey()),
+			n.fullKey(p.valueKey()),
+			n.fullKey(p.notifyKey()),
+			n.fullKey(oldKey),
+			n.fullKey(NotifyLockPrefix + RedisKeySep + oldKey),
+		}
+		ret, err := upsertKeyspaceScript.Run(n.cache.NativeCmd(), keys,
+			mode.String(), old, p.count, int64(delay/time.Millisecond),
+			toMillis(n.clock.Now().Add(delay)), int64(n.holdingAfter(delay)/time.Millisecond), p.Value).Result()
+		if nil != err {
+			return false, err
+		}
+		switch ret {
+		case int64(-1):
+			continue
+		case int64(1):
+			n.observer.Observe(n.prefix, EventScheduled)
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+	return false, errPutConflict
+}
+
+func (n *scheduledNotification) PutNotificationMode(p *Entity, mode PutMode) (bool, error) {
+	if err := checkPutMode(mode); err != nil {
+		return false, err
+	}
+	delay := n.delay(p, p.count)
+	keys := []string{
+		n.fullKey(p.stateKey()),
+		n.fullKey(p.valueKey()),
+		n.fullKey(NotifySchedulePrefix),
+		n.fullKey(NotifyProcessingPrefix),
+	}
+	ret, err := upsertScheduleScript.Run(n.cache.NativeCmd(), keys,
+		mode.String(), p.encodedKey(), p.count, toMillis(n.clock.Now().Add(delay)),
+		int64(n.holdingAfter(delay)/time.Millisecond), p.Value).Result()
+	if nil != err {
+		return false, err
+	}
+	if ret != int64(1) {
+		return false, nil
+	}
+	n.observer.Observe(n.prefix, EventScheduled)
+	return true, nil
+}
@@ -0,0 +1,265 @@
+package redisplus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeyspacePutMode(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	s, n := newTestKeyspace(t, WithClock(clock))
+	s.SetTime(clock.now)
+	first := &Entity{Key: "1", Value: []byte("a")}
+	notify := func(count int64) string {
+		return n.fullKey((&Entity{Key: "1", count: count}).notifyKey())
+	}
+
+	if ok, err := n.PutNotificationMode(first, PutIfAbsent); err != nil || !ok || s.TTL(notify(0)) != time.Minute {
+		t.Fatal("insert", ok, err)
+	}
+	if ok, err := n.PutNotificationMode(&Entity{Key: "1", Value: []byte("b")}, PutIfAbsent); err != nil || ok {
+		t.Fatal("insert over a pending notification", ok, err)
+	}
+	for _, key := range s.Keys() {
+		if KeySlot(key) != KeySlot(first.tag()) {
+			t.Fatal("key is not in the entity slot", key)
+		}
+	}
+
+	//替换为第二次重试
+	if ok, err := n.PutNotificationMode(&Entity{Key: "1", count: 1, Value: []byte("b")}, PutReplace); err != nil || !ok {
+		t.Fatal("replace", ok, err)
+	}
+	if s.Exists(notify(0)) || s.TTL(notify(1)) != 2*time.Minute {
+		t.Fatal("replace did not move the notification", s.Keys())
+	}
+	if count, _ := n.fetchCount(first); count != 1 {
+		t.Fatal("replaced count", count)
+	}
+
+	//推迟: 保留重试次数, 只在更晚时修改触发时间
+	s.FastForward(30 * time.Second)
+	clock.now = clock.now.Add(30 * time.Second)
+	if ok, err := n.PutNotificationMode(&Entity{Key: "1", Value: []byte("c")}, PutExtend); err != nil || !ok {
+		t.Fatal("extend", ok, err)
+	}
+	if ttl := s.TTL(notify(1)); ttl != 90*time.Second {
+		t.Fatal("extend to an earlier time changed the ttl", ttl)
+	}
+	if ok, _ := n.PutNotificationMode(&Entity{Key: "1", count: 1, Value: []byte("d")}, PutExtend); !ok || s.TTL(notify(1)) != 2*time.Minute {
+		t.Fatal("extend to a later time", s.TTL(notify(1)))
+	}
+	if due, _ := n.fetchDue(first); !due.Equal(clock.now.Add(2 * time.Minute)) {
+		t.Fatal("extended due", due)
+	}
+	if value, _ := s.Get(n.fullKey(first.valueKey())); value != "d" {
+		t.Fatal("extended value", value)
+	}
+	if count, _ := n.fetchCount(first); count != 1 || s.Exists(notify(0)) {
+		t.Fatal("extend changed the count", count)
+	}
+
+	//通知已触发后可以重新写入
+	s.Del(notify(1))
+	if ok, err := n.PutNotificationMode(first, PutIfAbsent); err != nil || !ok || !s.Exists(notify(0)) {
+		t.Fatal("insert after fire", ok, err)
+	}
+	if ok, err := n.PutNotificationMode(&Entity{Key: "2"}, PutExtend); err != nil || !ok {
+		t.Fatal("extend without a pending notification", ok, err)
+	}
+	if _, err := n.PutNotificationMode(first, PutMode(9)); err != errPutMode {
+		t.Fatal(err)
+	}
+
+	//状态在读取之后被修改
+	keys := []string{n.fullKey(first.stateKey()), n.fullKey(first.valueKey()), notify(0), notify(0),
+		n.fullKey(NotifyLockPrefix + RedisKeySep + first.notifyKey())}
+	if ret, err := upsertKeyspaceScript.Run(n.cache.NativeCmd(), keys, "insert", "7", 0, 1, 1, 1, "").Result(); err != nil || ret != int64(-1) {
+		t.Fatal("stale count", ret, err)
+	}
+}
+
+//TestKeyspacePutInFlight handler 处理中的通知视为存在, 处理结束时不删除之后写入的通知
+func TestKeyspacePutInFlight(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	source := &keyspaceSource{n: n}
+	running := &Entity{Key: "1", Value: []byte("a")}
+	n.PutNotification(running)
+	s.Del(n.fullKey(running.notifyKey()))
+	if ok, _ := n.lock(running); !ok {
+		t.Fatal("lock")
+	}
+	for _, mode := range []PutMode{PutIfAbsent, PutReplace, PutExtend} {
+		if ok, err := n.PutNotificationMode(&Entity{Key: "1", Value: []byte("b")}, mode); err != nil || ok {
+			t.Fatal(mode, "wrote over an in-flight notification", ok, err)
+		}
+	}
+	if value, _ := s.Get(n.fullKey(running.valueKey())); value != "a" || len(s.Keys()) != 3 {
+		t.Fatal("in-flight notification was modified", value, s.Keys())
+	}
+
+	//锁已丢失时写入新的通知, 原 handler 结束时不删除新的 value 与状态
+	s.Del(n.fullKey(NotifyLockPrefix + RedisKeySep + running.notifyKey()))
+	if ok, err := n.PutNotificationMode(&Entity{Key: "1", count: 1, Value: []byte("b")}, PutReplace); err != nil || !ok {
+		t.Fatal("replace after the lock was lost", ok, err)
+	}
+	s.Set(n.fullKey(NotifyLockPrefix+RedisKeySep+running.notifyKey()), running.token)
+	source.ack(running, false)
+	if value, _ := s.Get(n.fullKey(running.valueKey())); value != "b" {
+		t.Fatal("ack removed the value of a newer notification", s.Keys())
+	}
+	if count, err := n.fetchCount(running); err != nil || count != 1 {
+		t.Fatal("ack removed the state of a newer notification", count, err)
+	}
+	if s.Exists(n.fullKey(NotifyLockPrefix + RedisKeySep + running.notifyKey())) {
+		t.Fatal("lock was not released")
+	}
+}
+
+func TestScheduledPutMode(t *testing.T) {
+	s, n, clock := newTestScheduled(t)
+	schedule := n.fullKey(NotifySchedulePrefix)
+	first := &Entity{Key: "1", Value: []byte("a")}
+	due := func(member string) time.Duration {
+		score, err := s.ZScore(schedule, member)
+		if err != nil {
+			return 0
+		}
+		return fromMillis(score).Sub(clock.now)
+	}
+
+	if ok, err := n.PutNotificationMode(first, PutIfAbsent); err != nil || !ok || due("MQ==:0") != time.Minute {
+		t.Fatal("insert", ok, err)
+	}
+	if ok, _ := n.PutNotificationMode(first, PutIfAbsent); ok {
+		t.Fatal("insert over a pending notification")
+	}
+	for _, key := range s.Keys() {
+		if KeySlot(key) != KeySlot("{order}") {
+			t.Fatal("key is not in the notification slot", key)
+		}
+	}
+
+	if ok, err := n.PutNotificationMode(&Entity{Key: "1", count: 1, Value: []byte("b")}, PutReplace); err != nil || !ok {
+		t.Fatal("replace", ok, err)
+	}
+	if members, _ := s.ZMembers(schedule); len(members) != 1 || due("MQ==:1") != 2*time.Minute {
+		t.Fatal("replace did not move the notification", members)
+	}
+
+	clock.now = clock.now.Add(30 * time.Second)
+	if ok, _ := n.PutNotificationMode(&Entity{Key: "1", Value: []byte("c")}, PutExtend); !ok || due("MQ==:1") != 90*time.Second {
+		t.Fatal("extend to an earlier time changed the due", due("MQ==:1"))
+	}
+	if ok, _ := n.PutNotificationMode(&Entity{Key: "1", count: 1, Value: []byte("d")}, PutExtend); !ok || due("MQ==:1") != 2*time.Minute {
+		t.Fatal("extend to a later time", due("MQ==:1"))
+	}
+	if value, _ := s.Get(n.fullKey(first.valueKey())); value != "d" {
+		t.Fatal("extended value", value)
+	}
+	if ok, _ := n.PutNotificationMode(&Entity{Key: "2"}, PutExtend); !ok || due("Mg==:0") != time.Minute {
+		t.Fatal("extend without a pending notification")
+	}
+
+	//认领后处理中的通知视为存在
+	clock.now = clock.now.Add(2 * time.Minute)
+	claimed, _ := n.claim(10)
+	if len(claimed) != 2 {
+		t.Fatal(claimed)
+	}
+	for _, mode := range []PutMode{PutIfAbsent, PutReplace, PutExtend} {
+		if ok, err := n.PutNotificationMode(&Entity{Key: "1", Value: []byte("e")}, mode); err != nil || ok {
+			t.Fatal(mode, "wrote over an in-flight notification", ok, err)
+		}
+	}
+	if members, _ := s.ZMembers(schedule); len(members) != 0 {
+		t.Fatal("in-flight notification was scheduled again", members)
+	}
+
+	//处理期间状态被重新写入时, 结束处理不删除新的 value 与状态
+	source := &scheduleSource{n: n}
+	n.putState(&Entity{Key: "2", count: 1}, time.Minute)
+	for _, entity := range claimed {
+		source.ack(entity, false)
+	}
+	if s.Exists(n.fullKey(first.valueKey())) {
+		t.Fatal("finished notification was not removed")
+	}
+	if count, err := n.fetchCount(&Entity{Key: "2"}); err != nil || count != 1 {
+		t.Fatal("ack removed the state of a newer notification", count, err)
+	}
+}
+
+//TestKeyspaceLegacyKeys 升级前写入的通知 key 与 value 不带 hash tag
+func TestKeyspaceLegacyKeys(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	s, n := newTestKeyspace(t, WithClock(clock))
+	s.SetTime(clock.now)
+	legacy := func(key string) (notify, value string) {
+		encoded := (&Entity{Key: key}).encodedKey()
+		return "TEST:dev:order:NOTIFY:" + encoded + ":0", "TEST:dev:order:NOTIFY_VALUE:" + encoded
+	}
+	for _, key := range []string{"1", "2"} {
+		notify, value := legacy(key)
+		s.Set(notify, "")
+		s.SetTTL(notify, time.Minute)
+		s.Set(value, "v"+key)
+	}
+
+	p, err := n.Get("1")
+	if err != nil || string(p.Value) != "v1" || !p.DueAt.Equal(clock.now.Add(time.Minute)) {
+		t.Fatal("get a legacy notification", p, err)
+	}
+	if all, _, err := n.Pending(0); err != nil || len(all) != 2 || string(all[0].Value) == "" {
+		t.Fatal("pending legacy notifications", all, err)
+	}
+
+	//修改触发时间时迁移到新的 key
+	at := clock.now.Add(time.Hour)
+	if err := n.Reschedule("1", at); err != nil {
+		t.Fatal(err)
+	}
+	if notify, value := legacy("1"); s.Exists(notify) || s.Exists(value) {
+		t.Fatal("legacy keys were not removed", s.Keys())
+	}
+	if p, err := n.Get("1"); err != nil || string(p.Value) != "v1" || !p.DueAt.Equal(at) {
+		t.Fatal("migrated notification", p, err)
+	}
+
+	deliveries := make(chan *Delivery, 1)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		deliveries <- d
+		return Retry(nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+	waitFor(t, func() bool { return s.PubSubNumPat() > 0 })
+	notify, value := legacy("2")
+	s.Del(notify)
+	s.Publish("__keyspace@0__:"+notify, "expired")
+	//旧的通知先迁移到新的 key 并立即重新触发, 旧的 value 与锁被删除
+	migrated := n.fullKey((&Entity{Key: "2"}).notifyKey())
+	waitFor(t, func() bool { return !s.Exists(value) && s.Exists(migrated) })
+	if s.Exists("TEST:dev:order:" + NotifyLockPrefix + ":" + notify[len("TEST:dev:order:"):]) {
+		t.Fatal("legacy lock was not released", s.Keys())
+	}
+	select {
+	case d := <-deliveries:
+		t.Fatal("legacy notification handed to the handler", d.Entity)
+	default:
+	}
+	s.Del(migrated)
+	s.Publish("__keyspace@0__:"+migrated, "expired")
+	if d := receiveDelivery(t, deliveries); d.Entity.Key != "2" || string(d.Entity.Value) != "v2" || d.Attempt != 0 {
+		t.Fatal("migrated delivery", d.Entity, d.Err)
+	}
+	if p, err := n.Get("2"); err != nil || p.Count != 1 || string(p.Value) != "v2" {
+		t.Fatal("requeued legacy notification", p, err)
+	}
+	if err := n.Cancel("1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,180 @@
+// retry policy builders for notifications
+
+package redisplus
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 通知的重试策略.
+// 基础序列为每次触发的最大延迟, 用于计算 value 与锁的保留时间;
+// 实际延迟由具体策略按通知 key 计算, 保证同一时刻写入的大量通知分散触发
+type RetryPolicy struct {
+	delays []time.Duration
+	//next 计算第 attempt 次触发的延迟, 为空时使用基础序列
+	next func(key string, attempt int, now time.Time) time.Duration
+	//jitter 在 [delay*(1-jitter), delay] 区间内按 key 随机延迟
+	jitter float64
+}
+
+// Policies 使用固定的延迟序列构造重试策略, 与 DefaultRetryPolicies 的语义相同
+func Policies(delays ...time.Duration) RetryPolicy {
+	return RetryPolicy{delays: delays}
+}
+
+// ExponentialPolicy 以 base 为初始延迟, 每次重试延迟翻倍, 最大不超过 max
+func ExponentialPolicy(base, max time.Duration, attempts int) RetryPolicy {
+	delays := make([]time.Duration, 0, attempts)
+	delay := base
+	for i := 0; i < attempts; i++ {
+		delays = append(delays, capDelay(delay, max))
+		delay = growDelay(delay, max, 2)
+	}
+	return RetryPolicy{delays: delays}
+}
+
+// LinearPolicy 以 base 为初始延迟, 每次重试增加 step
+func LinearPolicy(base, step time.Duration, attempts int) RetryPolicy {
+	delays := make([]time.Duration, 0, attempts)
+	for i := 0; i < attempts; i++ {
+		delays = append(delays, base+step*time.Duration(i))
+	}
+	return RetryPolicy{delays: delays}
+}
+
+// FibonacciPolicy 延迟按斐波那契数列 base, base, 2*base, 3*base ... 增长, 最大不超过 max
+func FibonacciPolicy(base, max time.Duration, attempts int) RetryPolicy {
+	delays := make([]time.Duration, 0, attempts)
+	prev, delay := time.Duration(0), base
+	for i := 0; i < attempts; i++ {
+		delays = append(delays, capDelay(delay, max))
+		if (max > 0 && delay >= max) || delay > math.MaxInt64-prev {
+			continue
+		}
+		prev, delay = delay, prev+delay
+	}
+	return RetryPolicy{delays: delays}
+}
+
+// FixedTimesPolicy 在每天的固定时刻触发, clocks 为距零点的时间, 如 2*time.Hour 表示 02:00
+func FixedTimesPolicy(attempts int, clocks ...time.Duration) RetryPolicy {
+	sorted := make([]time.Duration, 0, len(clocks))
+	for _, clock := range clocks {
+		sorted = append(sorted, clock%(24*time.Hour))
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	delays := make([]time.Duration, 0, attempts)
+	if len(sorted) > 0 {
+		for i := 0; i < attempts; i++ {
+			delays = append(delays, 24*time.Hour)
+		}
+	}
+	return RetryPolicy{
+		delays: delays,
+		next: func(key string, attempt int, now time.Time) time.Duration {
+			return untilNextClock(now, sorted)
+		},
+	}
+}
+
+// DecorrelatedJitterPolicy 每次延迟在 [base, 上一次延迟*3] 区间内随机, 最大不超过 max.
+// 同一个 key 的延迟序列是确定的, 不同 key 的序列互不相关
+func DecorrelatedJitterPolicy(base, max time.Duration, attempts int) RetryPolicy {
+	delays := make([]time.Duration, 0, attempts)
+	delay := base
+	for i := 0; i < attempts; i++ {
+		delays = append(delays, capDelay(delay, max))
+		delay = growDelay(delay, max, 3)
+	}
+	return RetryPolicy{
+		delays: delays,
+		next: func(key string, attempt int, now time.Time) time.Duration {
+			r := rand.New(rand.NewSource(entitySeed(key, 0)))
+			delay := base
+			for i := 1; i <= attempt; i++ {
+				upper := capDelay(growDelay(delay, max, 3), max)
+				if upper < base {
+					upper = base
+				}
+				delay = capDelay(base+time.Duration(r.Int63n(int64(upper-base)+1)), max)
+			}
+			return delay
+		},
+	}
+}
+
+// WithJitter 返回在每次延迟上增加随机抖动的策略, 实际延迟在 [delay*(1-factor), delay] 之间,
+// factor 取值 [0, 1)
+func (p RetryPolicy) WithJitter(factor float64) RetryPolicy {
+	if factor < 0 {
+		factor = 0
+	}
+	if factor >= 1 {
+		factor = 0.99
+	}
+	p.jitter = factor
+	return p
+}
+
+// Delays 返回策略的基础延迟序列
+func (p RetryPolicy) Delays() []time.Duration {
+	return append([]time.Duration(nil), p.delays...)
+}
+
+//delay 计算 key 第 attempt 次触发的延迟, 至少为 1ms
+func (p RetryPolicy) delay(key string, attempt int, now time.Time) time.Duration {
+	var delay time.Duration
+	if p.next != nil {
+		delay = p.next(key, attempt, now)
+	} else {
+		delay = p.delays[attempt]
+	}
+	if p.jitter > 0 {
+		r := rand.New(rand.NewSource(entitySeed(key, attempt)))
+		delay -= time.Duration(float64(delay) * p.jitter * r.Float64())
+	}
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
+
+//entitySeed 由 key 与重试次数生成随机数种子
+func entitySeed(key string, attempt int) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte(RedisKeySep + strconv.Itoa(attempt)))
+	return int64(h.Sum64())
+}
+
+func capDelay(delay, max time.Duration) time.Duration {
+	if max > 0 && delay > max {
+		return max
+	}
+	return delay
+}
+
+//growDelay 将 delay 乘以 factor, 达到 max 或将要溢出时不再增长
+func growDelay(delay, max, factor time.Duration) time.Duration {
+	if (max > 0 && delay >= max) || delay > math.MaxInt64/factor {
+		return delay
+	}
+	return delay * factor
+}
+
+//untilNextClock 距离下一个固定时刻的时间
+func untilNextClock(now time.Time, clocks []time.Duration) time.Duration {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, clock := range clocks {
+		if at := midnight.Add(clock); at.After(now) {
+			return at.Sub(now)
+		}
+	}
+	return midnight.AddDate(0, 0, 1).Add(clocks[0]).Sub(now)
+}
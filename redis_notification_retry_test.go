@@ -0,0 +1,106 @@
+package redisplus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelays(t *testing.T) {
+	s := time.Second
+	cases := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{"exponential", ExponentialPolicy(s, 10*s, 5), []time.Duration{s, 2 * s, 4 * s, 8 * s, 10 * s}},
+		{"exponential no cap", ExponentialPolicy(s, 0, 3), []time.Duration{s, 2 * s, 4 * s}},
+		{"linear", LinearPolicy(s, 2*s, 4), []time.Duration{s, 3 * s, 5 * s, 7 * s}},
+		{"fibonacci", FibonacciPolicy(s, 5*s, 6), []time.Duration{s, s, 2 * s, 3 * s, 5 * s, 5 * s}},
+		{"fixed times", FixedTimesPolicy(2, time.Hour), []time.Duration{24 * time.Hour, 24 * time.Hour}},
+		{"fixed times no clock", FixedTimesPolicy(2), nil},
+		{"decorrelated jitter", DecorrelatedJitterPolicy(s, 10*s, 4), []time.Duration{s, 3 * s, 9 * s, 10 * s}},
+	}
+	for _, c := range cases {
+		if got := c.policy.Delays(); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyOverflow(t *testing.T) {
+	max := 24 * time.Hour
+	policies := map[string]RetryPolicy{
+		"exponential":         ExponentialPolicy(time.Second, max, 100),
+		"fibonacci":           FibonacciPolicy(time.Second, max, 100),
+		"decorrelated jitter": DecorrelatedJitterPolicy(time.Second, max, 100),
+		"exponential no cap":  ExponentialPolicy(time.Second, 0, 100),
+	}
+	for name, policy := range policies {
+		for attempt, delay := range policy.Delays() {
+			if delay <= 0 || (name != "exponential no cap" && delay > max) {
+				t.Fatalf("%s: attempt %d delay %v", name, attempt, delay)
+			}
+			if got := policy.delay("k", attempt, time.Now()); got <= 0 {
+				t.Fatalf("%s: attempt %d actual delay %v", name, attempt, got)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyNext(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	fixed := FixedTimesPolicy(3, 2*time.Hour, 12*time.Hour)
+	cases := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{now, 2 * time.Hour},
+		{now.Add(2 * time.Hour), 14 * time.Hour},
+		{now.Add(-10 * time.Hour), 2 * time.Hour},
+	}
+	for _, c := range cases {
+		if got := fixed.delay("k", 0, c.now); got != c.want {
+			t.Fatalf("fixed times at %v: got %v, want %v", c.now, got, c.want)
+		}
+	}
+
+	jitter := DecorrelatedJitterPolicy(time.Second, time.Minute, 5)
+	for attempt := 0; attempt < 5; attempt++ {
+		got := jitter.delay("k", attempt, now)
+		if got < time.Second || got > time.Minute || got != jitter.delay("k", attempt, now) {
+			t.Fatalf("decorrelated jitter attempt %d: %v", attempt, got)
+		}
+	}
+	if got := jitter.delay("k", 0, now); got != time.Second {
+		t.Fatal("first decorrelated delay is not base", got)
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := Policies(time.Minute, 2*time.Minute).WithJitter(0.5)
+	now := time.Now()
+	differs := false
+	for attempt := 0; attempt < 2; attempt++ {
+		base := policy.Delays()[attempt]
+		first := policy.delay("a", attempt, now)
+		if first < base/2 || first > base {
+			t.Fatalf("attempt %d: %v out of [%v, %v]", attempt, first, base/2, base)
+		}
+		if again := policy.delay("a", attempt, now); again != first {
+			t.Fatalf("attempt %d: jitter is not deterministic per key, %v != %v", attempt, first, again)
+		}
+		if policy.delay("b", attempt, now) != first {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Fatal("jitter is the same for different keys")
+	}
+	if p := Policies(time.Minute).WithJitter(2); p.jitter >= 1 {
+		t.Fatal(p.jitter)
+	}
+	if got := Policies(0).delay("a", 0, now); got != time.Millisecond {
+		t.Fatal("delay below 1ms", got)
+	}
+}
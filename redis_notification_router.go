@@ -0,0 +1,128 @@
+// route notifications to handlers by key pattern
+
+package redisplus
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Router 按 Entity.Key 将通知分发给不同的 handler, 按注册顺序匹配第一个路由.
+// Router.Handle 可直接作为 SubscribeDelivery 的 handler
+type Router struct {
+	mu       sync.RWMutex
+	routes   []*route
+	fallback DeliveryHandler
+}
+
+type route struct {
+	pattern *regexp.Regexp
+	handler DeliveryHandler
+	//policy 路由自己的重试策略, 为空时使用 Notification 的重试策略
+	policy *RetryPolicy
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Glob 注册 redis 风格的 glob 路由, 支持 * ? 与 [...]
+func (r *Router) Glob(pattern string, handler DeliveryHandler, policy ...RetryPolicy) error {
+	return r.Regexp("^"+globToRegexp(pattern)+"$", handler, policy...)
+}
+
+// Regexp 注册正则表达式路由.
+// 指定 policy 时按路由的策略计算重试延迟与次数, 代替 Notification 的重试策略
+func (r *Router) Regexp(expr string, handler DeliveryHandler, policy ...RetryPolicy) error {
+	pattern, err := regexp.Compile(expr)
+	if nil != err {
+		return err
+	}
+	rt := &route{pattern: pattern, handler: handler}
+	if len(policy) > 0 {
+		rt.policy = &policy[0]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, rt)
+	return nil
+}
+
+// Fallback 设置没有匹配路由时的 handler, 未设置时未匹配的通知直接结束
+func (r *Router) Fallback(handler DeliveryHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = handler
+}
+
+// Handle 分发通知
+func (r *Router) Handle(ctx context.Context, d *Delivery) Result {
+	rt, fallback := r.match(d.Entity.Key)
+	if nil == rt {
+		if nil == fallback {
+			return Done()
+		}
+		return fallback(ctx, d)
+	}
+	if nil == rt.policy {
+		return rt.handler(ctx, d)
+	}
+
+	d.Attempts = len(rt.policy.delays)
+	result := rt.handler(ctx, d)
+	if result.Action != ActionRetry {
+		return result
+	}
+	if d.Last() {
+		return ToDeadLetter(result.Err)
+	}
+	return RetryAfter(rt.policy.delay(d.Entity.Key, d.Attempt+1, d.FiredAt), result.Err)
+}
+
+func (r *Router) match(key string) (*route, DeliveryHandler) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rt := range r.routes {
+		if rt.pattern.MatchString(key) {
+			return rt, nil
+		}
+	}
+	return nil, r.fallback
+}
+
+//globToRegexp 将 redis 风格的 glob 转换为正则表达式
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
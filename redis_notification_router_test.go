@@ -0,0 +1,69 @@
+package redisplus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRouterHandle(t *testing.T) {
+	var matched string
+	handler := func(name string) DeliveryHandler {
+		return func(ctx context.Context, d *Delivery) Result {
+			matched = name
+			return Done()
+		}
+	}
+	router := NewRouter()
+	router.Glob("order:*", handler("order"))
+	router.Glob("order:vip:*", handler("vip"))
+	router.Regexp(`^user:\d+$`, handler("user"))
+	router.Glob("user:[ab]?", handler("user glob"))
+	if err := router.Regexp("(", handler("bad")); err == nil {
+		t.Fatal("invalid regexp")
+	}
+
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{"order:1", "order"},
+		{"order:vip:1", "order"}, //按注册顺序匹配第一个路由
+		{"user:42", "user"},
+		{"user:a1", "user glob"},
+		{"user:c1", ""},
+		{"orders", ""},
+	}
+	for _, c := range cases {
+		matched = ""
+		d := &Delivery{Entity: &Entity{Key: c.key}}
+		if result := router.Handle(context.Background(), d); result.Action != ActionDone || matched != c.want {
+			t.Fatalf("%s: matched %q, want %q", c.key, matched, c.want)
+		}
+	}
+
+	router.Fallback(handler("fallback"))
+	matched = ""
+	router.Handle(context.Background(), &Delivery{Entity: &Entity{Key: "none"}})
+	if matched != "fallback" {
+		t.Fatal(matched)
+	}
+}
+
+func TestRouterPolicy(t *testing.T) {
+	router := NewRouter()
+	retry := func(ctx context.Context, d *Delivery) Result {
+		return Retry(nil)
+	}
+	router.Glob("*", retry, Policies(time.Second, 2*time.Second))
+
+	d := &Delivery{Entity: &Entity{Key: "1"}, Attempts: 6}
+	result := router.Handle(context.Background(), d)
+	if result.Action != ActionRetryAfter || result.Delay != 2*time.Second || d.Attempts != 2 {
+		t.Fatal(result, d.Attempts)
+	}
+	d = &Delivery{Entity: &Entity{Key: "1", count: 1}, Attempt: 1}
+	if result := router.Handle(context.Background(), d); result.Action != ActionDeadLetter {
+		t.Fatal(result)
+	}
+}
@@ -0,0 +1,245 @@
+// redis sorted set scheduled notification
+
+package redisplus
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"gopkg.in/redis.v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const NotifySchedulePrefix = "NOTIFY_SCHEDULE"
+const NotifyProcessingPrefix = "NOTIFY_PROCESSING"
+const NotifyLeasePrefix = "NOTIFY_LEASE"
+
+//claimScript 将处理超时的通知放回调度队列, 再把到期通知移入处理队列, 并记录本次认领的租约 token
+//KEYS[1] 调度队列 KEYS[2] 处理队列 KEYS[3] 租约 token
+//ARGV[1] 当前时间(ms) ARGV[2] 单次数量 ARGV[3] 租约到期时间(ms) ARGV[4] 租约 token
+var claimScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], member)
+	redis.call('HDEL', KEYS[3], member)
+	redis.call('ZADD', KEYS[1], ARGV[1], member)
+end
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('ZADD', KEYS[2], ARGV[3], member)
+	redis.call('HSET', KEYS[3], member, ARGV[4])
+end
+return due
+`)
+
+//releaseScript 租约 token 一致时将已认领但未处理的通知放回调度队列
+//KEYS[1] 调度队列 KEYS[2] 处理队列 KEYS[3] 租约 token
+//ARGV[1] member ARGV[2] 重新触发的时间(ms) ARGV[3] 租约 token
+var releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[3] then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+end
+return 1
+`)
+
+//ackScript 租约 token 一致时结束处理, finish 为 1 且状态中的重试次数未变化时同时删除 value 与状态
+//KEYS[1] 处理队列 KEYS[2] 租约 token KEYS[3] value KEYS[4] 状态
+//ARGV[1] member ARGV[2] 租约 token ARGV[3] finish ARGV[4] 重试次数
+var ackScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if ARGV[3] == '1' then
+	local count = redis.call('HGET', KEYS[4], 'count')
+	if not count or count == ARGV[4] then
+		redis.call('DEL', KEYS[3], KEYS[4])
+	end
+end
+return 1
+`)
+
+//调度队列 member: base64(key):count
+func (e *Entity) member() string {
+	return e.encodedKey() + RedisKeySep + strconv.FormatInt(e.count, 10)
+}
+
+//decodeMember 由调度队列 member 还原 Entity
+func decodeMember(member string) (*Entity, error) {
+	parts := strings.Split(member, RedisKeySep)
+	if len(parts) != 2 {
+		return nil, errKeyFormat
+	}
+	return parseEntity(parts[0], parts[1])
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(millis float64) time.Time {
+	return time.Unix(0, int64(millis)*int64(time.Millisecond))
+}
+
+// scheduledNotification 使用 sorted set 保存通知的到期时间, 轮询认领到期通知.
+// 不依赖 notify-keyspace-events, 订阅者不在线时到期的通知会在下次轮询时处理.
+// 所有 key 使用 {prefix} 作为 hash tag, 集群模式下调度脚本访问的 key 在同一个 slot
+type scheduledNotification struct {
+	*notification
+}
+
+func NewScheduledNotification(prefix string, cache RedisCli, opts ...NotificationOption) (Notification, error) {
+	n, err := newNotification(prefix, cache, opts...)
+	if err != nil {
+		return nil, err
+	}
+	n.tagged = true
+	sn := &scheduledNotification{notification: n}
+	n.schedule = sn.put
+	return sn, nil
+}
+
+func (n *scheduledNotification) PutNotification(p *Entity) error {
+	return n.put(p, n.delay(p, p.count))
+}
+
+func (n *scheduledNotification) put(p *Entity, delay time.Duration) error {
+	//先写入value, 保证通知到期时value已存在
+	if err := n.set(p.valueKey(), p.Value, n.holdingAfter(delay)); err != nil {
+		return err
+	}
+	if err := n.putState(p, delay); err != nil {
+		return err
+	}
+	due := n.clock.Now().Add(delay)
+	_, err := n.cache.ZAdd(n.key(NotifySchedulePrefix), &ZMember{
+		Score:  float64(toMillis(due)),
+		Member: []byte(p.member()),
+	})
+	if nil != err {
+		return err
+	}
+	n.observer.Observe(n.prefix, EventScheduled)
+	return nil
+}
+
+func (n *scheduledNotification) Subscribe(handler NotificationHandler, opts ...SubscribeOption) (Subscription, error) {
+	return n.SubscribeDelivery(adaptHandler(handler), opts...)
+}
+
+func (n *scheduledNotification) SubscribeDelivery(handler DeliveryHandler, opts ...SubscribeOption) (Subscription, error) {
+	o := newSubscribeOptions(n.workers, opts...)
+	n.logger.Info("poll schedule", "key", n.fullKey(NotifySchedulePrefix), "interval", o.pollInterval)
+	source := &scheduleSource{
+		n:            n,
+		pollInterval: o.pollInterval,
+		batchSize:    o.batchSize,
+	}
+	s := newSubscription(n.notification, source, handler, o)
+	go s.run()
+	return s, nil
+}
+
+//leaseToken 生成一次认领的租约 token, 续期与结束处理时校验
+func (n *scheduledNotification) leaseToken() string {
+	return fmt.Sprintf("%s:%s:%s", NotifyLeasePrefix, n.node, uuid.New().String())
+}
+
+//claim 原子地认领到期通知
+func (n *scheduledNotification) claim(batchSize int64) ([]*Entity, error) {
+	now := n.clock.Now()
+	token := n.leaseToken()
+	keys := []string{n.fullKey(NotifySchedulePrefix), n.fullKey(NotifyProcessingPrefix), n.fullKey(NotifyLeasePrefix)}
+	result, err := claimScript.Run(n.cache.NativeCmd(), keys,
+		toMillis(now), batchSize, toMillis(now.Add(n.lockTTL)), token).Result()
+	if nil != err {
+		return nil, err
+	}
+	members, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected claim result %v", result)
+	}
+
+	var entities []*Entity
+	for _, m := range members {
+		member, _ := m.(string)
+		entity, err := decodeMember(member)
+		if nil != err {
+			n.logger.Error("decode member", "member", member, "err", err)
+			n.observer.Observe(n.prefix, EventDecodeFailed)
+			n.cache.ZRem(n.key(NotifyProcessingPrefix), &ZMember{Member: []byte(member)})
+			n.cache.HDel(n.key(NotifyLeasePrefix), member)
+			continue
+		}
+		entity.token = token
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+//scheduleSource 基于 sorted set 轮询的通知来源
+type scheduleSource struct {
+	n            *scheduledNotification
+	pollInterval time.Duration
+	batchSize    int64
+}
+
+func (s *scheduleSource) receive(stop <-chan struct{}) ([]*Entity, error) {
+	entities, err := s.n.claim(s.batchSize)
+	//认领数量达到上限时立即继续认领
+	if nil == err && int64(len(entities)) >= s.batchSize {
+		return entities, nil
+	}
+	select {
+	case <-stop:
+	case <-time.After(s.pollInterval):
+	}
+	return entities, err
+}
+
+//ack 租约仍属于当前节点时结束处理, 租约已被其他节点认领时不修改通知
+func (s *scheduleSource) ack(entity *Entity, requeued bool) {
+	n := s.n
+	finish := "0"
+	if !requeued {
+		finish = "1"
+	}
+	keys := []string{
+		n.fullKey(NotifyProcessingPrefix),
+		n.fullKey(NotifyLeasePrefix),
+		n.fullKey(entity.valueKey()),
+		n.fullKey(entity.stateKey()),
+	}
+	ret, err := ackScript.Run(n.cache.NativeCmd(), keys, entity.member(), entity.token, finish, entity.count).Result()
+	if nil != err {
+		n.logger.Error("ack entity", "entity", entity, "err", err)
+		return
+	}
+	if ret != int64(1) {
+		n.logger.Warn("lease lost before ack", "entity", entity)
+	}
+}
+
+func (s *scheduleSource) release(entity *Entity) {
+	s.requeue(entity, 0)
+}
+
+func (s *scheduleSource) requeue(entity *Entity, delay time.Duration) {
+	n := s.n
+	keys := []string{n.fullKey(NotifySchedulePrefix), n.fullKey(NotifyProcessingPrefix), n.fullKey(NotifyLeasePrefix)}
+	err := releaseScript.Run(n.cache.NativeCmd(), keys, entity.member(), toMillis(n.clock.Now().Add(delay)), entity.token).Err()
+	if nil != err {
+		n.logger.Error("release entity", "entity", entity, "err", err)
+	}
+}
+
+func (s *scheduleSource) close() error {
+	return nil
+}
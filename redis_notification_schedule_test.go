@@ -0,0 +1,69 @@
+package redisplus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestScheduled(t *testing.T, opts ...NotificationOption) (*miniredis.Miniredis, *scheduledNotification, *manualClock) {
+	s, view := newTestView(t)
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	opts = append([]NotificationOption{WithClock(clock), WithPolicies(time.Minute, 2*time.Minute), WithLockTTL(10 * time.Second)}, opts...)
+	n, err := NewScheduledNotification("order", view, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, n.(*scheduledNotification), clock
+}
+
+func TestScheduledClaim(t *testing.T) {
+	s, n, clock := newTestScheduled(t)
+	source := &scheduleSource{n: n, batchSize: 10}
+	if err := n.PutNotification(&Entity{Key: "1", Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range s.Keys() {
+		if KeySlot(key) != KeySlot("{order}") {
+			t.Fatal("key is not in the notification slot", key)
+		}
+	}
+	schedule, processing := "TEST:dev:{order}:"+NotifySchedulePrefix, "TEST:dev:{order}:"+NotifyProcessingPrefix
+
+	if entities, err := n.claim(10); err != nil || len(entities) != 0 {
+		t.Fatal("claimed before due", entities, err)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	entities, err := n.claim(10)
+	if err != nil || len(entities) != 1 || entities[0].Key != "1" || entities[0].Count() != 0 {
+		t.Fatal(entities, err)
+	}
+	if score, _ := s.ZScore(processing, entities[0].member()); score != float64(toMillis(clock.now.Add(10*time.Second))) {
+		t.Fatal("lease deadline", score)
+	}
+	if entities, _ := n.claim(10); len(entities) != 0 {
+		t.Fatal("claimed a leased notification", entities)
+	}
+
+	//租约过期后重新认领
+	clock.now = clock.now.Add(11 * time.Second)
+	entities, err = n.claim(10)
+	if err != nil || len(entities) != 1 {
+		t.Fatal("lease expiry was not requeued", entities, err)
+	}
+
+	source.release(entities[0])
+	if members, _ := s.ZMembers(processing); len(members) != 0 {
+		t.Fatal("released notification is still processing", members)
+	}
+	if score, err := s.ZScore(schedule, entities[0].member()); err != nil || score != float64(toMillis(clock.now)) {
+		t.Fatal("released notification is not due now", score, err)
+	}
+
+	entities, _ = n.claim(10)
+	source.ack(entities[0], false)
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Fatal("acked notification left keys", keys)
+	}
+}
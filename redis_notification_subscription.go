@@ -0,0 +1,541 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// receiveTimeout 单次读取订阅消息的超时时间, 超时后检查是否已停止订阅
+const receiveTimeout = time.Second
+
+var errSubscriptionStopped = errors.New("subscription stopped")
+
+const (
+	defaultWorkers      = 1
+	defaultQueueSize    = 64
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+
+	// saturatedDelay worker 队列已满时放回的通知重新触发的延迟
+	saturatedDelay = time.Second
+)
+
+// Subscription 通知订阅句柄
+type Subscription interface {
+	// Stop 关闭 PubSub, 不取消处理中 handler 的 ctx 并等待其结束, 然后释放本订阅持有的通知锁.
+	// 使用 WithShutdownTimeout 限制等待时间
+	Stop() error
+	// Wait 阻塞直到订阅完全停止
+	Wait()
+	// Stats 返回 worker pool 的运行指标
+	Stats() SubscriptionStats
+	// Sweep 立即执行一次恢复扫描, 将丢失过期事件的通知重新交给 handler, 返回恢复的数量
+	Sweep() (int, error)
+}
+
+// SubscriptionStats worker pool 运行指标
+type SubscriptionStats struct {
+	Workers   int   //worker 数量
+	Queued    int64 //已加锁等待处理的通知数
+	InFlight  int64 //正在执行 handler 的通知数
+	Processed int64 //已完成处理的通知数
+	Saturated int64 //因队列已满而放回稍后重新触发的次数
+	Recovered int64 //恢复扫描重新触发的通知数
+}
+
+// SubscribeOption Subscribe 的可选配置
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	workers         int
+	queueSize       int
+	pollInterval    time.Duration
+	batchSize       int64
+	sweepInterval   time.Duration
+	shutdownTimeout time.Duration
+
+	enableKeyspaceEvents bool
+}
+
+func newSubscribeOptions(workers int, opts ...SubscribeOption) *subscribeOptions {
+	o := &subscribeOptions{
+		workers:      workers,
+		queueSize:    defaultQueueSize,
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithWorkers 设置本次订阅并发执行 handler 的 worker 数量, 覆盖 WithWorkerCount 设置的默认值,
+// 不大于 0 时使用默认值. 同一个 Entity.Key 总是由同一个 worker 串行处理
+func WithWorkers(workers int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if workers > 0 {
+			o.workers = workers
+		}
+	}
+}
+
+// WithQueueSize 设置每个 worker 的等待队列长度, 队列满时新的通知被放回并稍后重新触发,
+// 不影响其他 worker 的分发
+func WithQueueSize(size int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if size > 0 {
+			o.queueSize = size
+		}
+	}
+}
+
+// WithPollInterval 设置 sorted set 调度器没有到期通知时的轮询间隔
+func WithPollInterval(interval time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if interval > 0 {
+			o.pollInterval = interval
+		}
+	}
+}
+
+// WithBatchSize 设置 sorted set 调度器单次认领到期通知的最大数量
+func WithBatchSize(size int64) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if size > 0 {
+			o.batchSize = size
+		}
+	}
+}
+
+// WithSweepInterval 开启周期性的恢复扫描, 重新触发部署等期间错过过期事件的通知
+func WithSweepInterval(interval time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if interval > 0 {
+			o.sweepInterval = interval
+		}
+	}
+}
+
+// WithShutdownTimeout 设置 Stop 等待处理中 handler 的最长时间, 超时后取消 handler 的 ctx.
+// 默认一直等待 handler 执行结束
+func WithShutdownTimeout(timeout time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		if timeout > 0 {
+			o.shutdownTimeout = timeout
+		}
+	}
+}
+
+//notificationSource 到期通知的来源, 由不同的存储实现
+type notificationSource interface {
+	//receive 读取到期通知, 返回的通知已被当前节点锁定
+	receive(stop <-chan struct{}) ([]*Entity, error)
+	//ack 通知处理结束, requeued 表示已投递下一次通知
+	ack(entity *Entity, requeued bool)
+	//release 放弃尚未处理的通知, 使其他节点可以立即接管
+	release(entity *Entity)
+	//requeue 放弃尚未处理的通知, 使其在 delay 之后重新触发
+	requeue(entity *Entity, delay time.Duration)
+	//sweep 查找错过到期处理的通知, 返回的通知已被当前节点锁定
+	sweep() ([]*Entity, error)
+	//renew 为当前节点持有的通知续期, 锁已被其他节点持有时返回 false
+	renew(entity *Entity) (bool, error)
+	close() error
+}
+
+//heldEntity 本订阅持有的通知, 锁丢失时取消 handler 的 ctx
+type heldEntity struct {
+	entity *Entity
+	cancel context.CancelFunc //handler 执行期间有效
+	lost   bool
+}
+
+type subscription struct {
+	n       *notification
+	source  notificationSource
+	handler DeliveryHandler
+	queues  []chan *Entity
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	sweepInterval   time.Duration
+	shutdownTimeout time.Duration //Stop 之后等待处理中 handler 的时间, 超时后取消其 ctx, 为 0 时一直等待
+	sweeper         sync.WaitGroup
+	sweeping        sync.Mutex //Sweep 执行期间持有, 停止时等待正在执行的扫描结束后再释放锁
+	renewer         sync.WaitGroup
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+	workers  sync.WaitGroup
+	closeErr error
+
+	mu    sync.Mutex
+	locks map[string]*heldEntity //本订阅持有且尚未处理完成的通知
+
+	queued    int64
+	inFlight  int64
+	processed int64
+	saturated int64
+	recovered int64
+}
+
+func newSubscription(n *notification, source notificationSource, handler DeliveryHandler, o *subscribeOptions) *subscription {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscription{
+		n:       n,
+		source:  source,
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+		queues:  make([]chan *Entity, o.workers),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		locks:   make(map[string]*heldEntity),
+
+		sweepInterval:   o.sweepInterval,
+		shutdownTimeout: o.shutdownTimeout,
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan *Entity, o.queueSize)
+	}
+	return s
+}
+
+func (s *subscription) Stop() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.Wait()
+	return s.closeErr
+}
+
+func (s *subscription) Wait() {
+	<-s.done
+}
+
+func (s *subscription) Stats() SubscriptionStats {
+	return SubscriptionStats{
+		Workers:   len(s.queues),
+		Queued:    atomic.LoadInt64(&s.queued),
+		InFlight:  atomic.LoadInt64(&s.inFlight),
+		Processed: atomic.LoadInt64(&s.processed),
+		Saturated: atomic.LoadInt64(&s.saturated),
+		Recovered: atomic.LoadInt64(&s.recovered),
+	}
+}
+
+func (s *subscription) Sweep() (int, error) {
+	s.sweeping.Lock()
+	defer s.sweeping.Unlock()
+	if s.stopped() {
+		return 0, errSubscriptionStopped
+	}
+	entities, err := s.source.sweep()
+	for _, entity := range entities {
+		s.hold(entity)
+	}
+	for _, entity := range entities {
+		if !s.dispatch(entity) {
+			break
+		}
+	}
+	if len(entities) > 0 {
+		atomic.AddInt64(&s.recovered, int64(len(entities)))
+		s.n.logger.Info("recovered notifications", "count", len(entities))
+	}
+	return len(entities), err
+}
+
+//sweepLoop 周期性执行恢复扫描
+func (s *subscription) sweepLoop() {
+	defer s.sweeper.Done()
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(); err != nil && err != errSubscriptionStopped {
+				s.n.logger.Error("sweep notifications", "err", err)
+			}
+		}
+	}
+}
+
+func (s *subscription) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.done)
+
+	for _, queue := range s.queues {
+		s.workers.Add(1)
+		go s.work(queue)
+	}
+	if s.sweepInterval > 0 {
+		s.sweeper.Add(1)
+		go s.sweepLoop()
+	}
+	s.renewer.Add(1)
+	go s.renewLoop()
+	s.receive()
+
+	//先停止接收新的通知, 处理中的 handler 继续执行到结束, 期间仍为其续期
+	s.closeErr = s.source.close()
+	s.sweeper.Wait()
+	if s.shutdownTimeout > 0 {
+		timer := time.AfterFunc(s.shutdownTimeout, s.cancel)
+		defer timer.Stop()
+	}
+	s.workers.Wait()
+	s.cancel()
+	s.renewer.Wait()
+	s.release()
+}
+
+//receive 接收到期通知并分发, 直到订阅停止
+func (s *subscription) receive() {
+	for !s.stopped() {
+		entities, err := s.source.receive(s.stop)
+		if nil != err {
+			s.n.logger.Error("receive notification", "err", err)
+			//连接异常时稍后重试, 避免空转
+			select {
+			case <-s.stop:
+			case <-time.After(receiveTimeout):
+			}
+		}
+		for _, entity := range entities {
+			s.hold(entity)
+		}
+		for _, entity := range entities {
+			if !s.dispatch(entity) {
+				break
+			}
+		}
+	}
+}
+
+//dispatch 按 Entity.Key 分发给对应的 worker, 订阅已停止时返回 false.
+//worker 队列已满时不阻塞, 将通知放回稍后重新触发, 其他 key 的分发不受影响
+func (s *subscription) dispatch(entity *Entity) bool {
+	if s.stopped() {
+		//未分发的通知由 release 释放
+		return false
+	}
+	queue := s.queues[s.shard(entity.Key)]
+	atomic.AddInt64(&s.queued, 1)
+	select {
+	case queue <- entity:
+		return true
+	default:
+	}
+
+	atomic.AddInt64(&s.queued, -1)
+	atomic.AddInt64(&s.saturated, 1)
+	s.n.logger.Warn("notification worker saturated, requeued", "key", entity.Key, "delay", saturatedDelay)
+	s.forget(entity)
+	s.source.requeue(entity, saturatedDelay)
+	return true
+}
+
+//shard 同一个 key 总是落在同一个 worker 上, 保证同一 Entity 串行处理
+func (s *subscription) shard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(s.queues)))
+}
+
+func (s *subscription) work(queue chan *Entity) {
+	defer s.workers.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case entity := <-queue:
+			atomic.AddInt64(&s.queued, -1)
+			//已停止订阅时不再处理, 由 release 释放
+			if s.stopped() {
+				return
+			}
+			s.handle(entity)
+		}
+	}
+}
+
+//handle 执行 handler 并根据结果重新投递或结束通知
+func (s *subscription) handle(entity *Entity) {
+	n := s.n
+	defer s.forget(entity)
+	ctx, held := s.begin(entity)
+	//等待处理期间锁已丢失, 通知由新的持有者处理
+	if nil == held {
+		return
+	}
+
+	atomic.AddInt64(&s.inFlight, 1)
+	defer atomic.AddInt64(&s.inFlight, -1)
+	defer atomic.AddInt64(&s.processed, 1)
+
+	d := &Delivery{
+		Entity:   entity,
+		Attempt:  int(entity.count),
+		Attempts: n.policies.length(),
+		FiredAt:  n.clock.Now(),
+		Node:     n.node,
+		n:        n,
+	}
+	d.Err = n.fetchValue(entity)
+	if due, err := n.fetchDue(entity); err == nil {
+		d.ScheduledAt = due
+	}
+	n.observer.Observe(n.prefix, EventFired)
+
+	ctx, span := n.observer.StartSpan(ctx, d)
+	start := time.Now()
+	result := s.handler(ctx, d)
+	n.observer.ObserveHandler(n.prefix, time.Since(start), result.Action)
+	if s.lost(held) {
+		span.End()
+		n.logger.Warn("lock lost during handler, result discarded", "entity", entity)
+		return
+	}
+	err := result.Err
+	if nil == err {
+		err = d.Err
+	}
+	if nil != result.Err {
+		span.SetError(result.Err)
+	}
+	span.End()
+	n.recordAttempt(entity, d.FiredAt, err)
+
+	var delay time.Duration
+	switch result.Action {
+	case ActionDone:
+		s.source.ack(entity, false)
+		return
+	case ActionDeadLetter:
+		n.observer.Observe(n.prefix, EventDeadLettered)
+		s.bury(entity)
+		return
+	case ActionRetryAfter:
+		//延迟为 0 的通知 key 不会过期, 至少延迟 1ms
+		delay = result.Delay
+		if delay < time.Millisecond {
+			delay = time.Millisecond
+		}
+	default:
+		if !d.Last() {
+			delay = n.delay(entity, entity.count+1)
+		}
+	}
+	//重试策略已用完, 移入死信
+	if d.Last() {
+		n.observer.Observe(n.prefix, EventExhausted)
+		s.bury(entity)
+		return
+	}
+
+	next := &Entity{
+		count: entity.count + 1,
+		Key:   entity.Key,
+		Value: entity.Value,
+	}
+	if err := n.schedule(next, delay); err != nil {
+		n.logger.Error("requeue entity", "entity", next, "err", err)
+		return
+	}
+	n.observer.Observe(n.prefix, EventRetried)
+	s.source.ack(entity, true)
+}
+
+func (s *subscription) bury(entity *Entity) {
+	if err := s.n.bury(entity); err != nil {
+		s.n.logger.Error("bury entity", "entity", entity, "err", err)
+		return
+	}
+	s.source.ack(entity, false)
+}
+
+func (s *subscription) hold(entity *Entity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[entity.notifyKey()] = &heldEntity{entity: entity}
+}
+
+//begin 开始执行 handler, 返回锁丢失时取消的 ctx, 锁已丢失时返回 nil
+func (s *subscription) begin(entity *Entity) (context.Context, *heldEntity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held, ok := s.locks[entity.notifyKey()]
+	if !ok || held.entity != entity {
+		return nil, nil
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	held.cancel = cancel
+	return ctx, held
+}
+
+//lose 锁已被其他节点持有, 取消正在执行的 handler, 不再释放该通知
+func (s *subscription) lose(entity *Entity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := entity.notifyKey()
+	held, ok := s.locks[key]
+	if !ok || held.entity != entity {
+		return
+	}
+	held.lost = true
+	if held.cancel != nil {
+		held.cancel()
+	}
+	delete(s.locks, key)
+}
+
+func (s *subscription) lost(held *heldEntity) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return held.lost
+}
+
+func (s *subscription) forget(entity *Entity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := entity.notifyKey()
+	held, ok := s.locks[key]
+	if !ok || held.entity != entity {
+		return
+	}
+	if held.cancel != nil {
+		held.cancel()
+	}
+	delete(s.locks, key)
+}
+
+//release 释放仍持有但未处理的通知, 使其他节点可以立即接管
+func (s *subscription) release() {
+	s.sweeping.Lock()
+	defer s.sweeping.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, held := range s.locks {
+		s.source.release(held.entity)
+		delete(s.locks, key)
+	}
+	atomic.StoreInt64(&s.queued, 0)
+}
@@ -0,0 +1,177 @@
+package redisplus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterDelay(t *testing.T) {
+	s, n := newTestKeyspace(t, WithPolicies(time.Minute, 2*time.Minute, 3*time.Minute))
+	delays := []time.Duration{30 * time.Second, 0, -time.Second}
+	deliveries := make(chan *Delivery, len(delays))
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		deliveries <- d
+		return RetryAfter(delays[d.Attempt], nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	n.PutNotification(&Entity{Key: "1", Value: []byte("v")})
+	want := []time.Duration{30 * time.Second, time.Millisecond}
+	for attempt, delay := range want {
+		fireNotifications(s)
+		receiveDelivery(t, deliveries)
+		next := n.fullKey((&Entity{Key: "1", count: int64(attempt + 1)}).notifyKey())
+		waitFor(t, func() bool { return s.Exists(next) })
+		if ttl := s.TTL(next); ttl != delay {
+			t.Fatalf("attempt %d: retry after %v, got ttl %v, want %v", attempt, delays[attempt], ttl, delay)
+		}
+	}
+}
+
+//TestWorkerPoolKeyOrder 同一个 key 的通知按认领顺序串行处理
+func TestWorkerPoolKeyOrder(t *testing.T) {
+	_, n, clock := newTestScheduled(t, WithPolicies(time.Minute, time.Minute, time.Minute, time.Minute, time.Minute))
+	for count := int64(0); count < 5; count++ {
+		for _, key := range []string{"a", "b"} {
+			n.put(&Entity{Key: key, count: count}, time.Minute)
+		}
+	}
+	clock.now = clock.now.Add(time.Minute)
+
+	var mu sync.Mutex
+	order := make(map[string][]int64)
+	running := make(map[string]bool)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		key := d.Entity.Key
+		mu.Lock()
+		if running[key] {
+			t.Error("key handled concurrently", key)
+		}
+		running[key] = true
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running[key] = false
+		order[key] = append(order[key], d.Entity.count)
+		mu.Unlock()
+		return Done()
+	}, WithWorkers(4), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	waitFor(t, func() bool { return sub.Stats().Processed == 10 })
+	mu.Lock()
+	defer mu.Unlock()
+	for key, counts := range order {
+		for i, count := range counts {
+			if count != int64(i) {
+				t.Fatal("out of order", key, counts)
+			}
+		}
+	}
+}
+
+//TestWorkerPoolParallel 不同 worker 上的 key 并行处理, Stats 反映处理中与已完成的数量
+func TestWorkerPoolParallel(t *testing.T) {
+	_, n, clock := newTestScheduled(t)
+	release := make(chan struct{})
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		<-release
+		return Done()
+	}, WithWorkers(2), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sub.(*subscription)
+
+	//选择落在不同 worker 上的两个 key
+	keys := []string{"a"}
+	for i := 0; len(keys) < 2; i++ {
+		if key := strconv.Itoa(i); s.shard(key) != s.shard(keys[0]) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		n.PutNotification(&Entity{Key: key})
+	}
+	clock.advance(time.Minute)
+
+	waitFor(t, func() bool { return sub.Stats().InFlight == 2 })
+	if stats := sub.Stats(); stats.Workers != 2 || stats.Queued != 0 || stats.Processed != 0 {
+		t.Fatal(stats)
+	}
+	close(release)
+	sub.Stop()
+	if stats := sub.Stats(); stats.InFlight != 0 || stats.Processed != 2 {
+		t.Fatal(stats)
+	}
+}
+
+//TestWorkerPoolSaturated 队列已满的 worker 不阻塞其他 worker 的分发, 多出的通知放回稍后重新触发
+func TestWorkerPoolSaturated(t *testing.T) {
+	mr, n, clock := newTestScheduled(t)
+	release := make(chan struct{})
+	var handled sync.Map
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		handled.Store(d.Entity.Key, true)
+		if d.Entity.Key != "free" {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+		return Done()
+	}, WithWorkers(2), WithQueueSize(1), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+	s := sub.(*subscription)
+
+	//三个 key 落在同一个 worker 上: 一个处理中, 一个排队, 一个被放回
+	var busy []string
+	for i := 0; len(busy) < 3; i++ {
+		if key := strconv.Itoa(i); s.shard(key) != s.shard("free") {
+			busy = append(busy, key)
+		}
+	}
+	for _, key := range busy {
+		n.PutNotification(&Entity{Key: key})
+	}
+	clock.advance(time.Minute)
+	schedule := n.fullKey(NotifySchedulePrefix)
+	waitFor(t, func() bool {
+		members, _ := mr.ZMembers(schedule)
+		return len(members) == 1
+	})
+	if stats := sub.Stats(); stats.Saturated != 1 || stats.Queued != 1 || stats.InFlight != 1 {
+		t.Fatal(stats)
+	}
+	members, _ := mr.ZMembers(schedule)
+	if score, _ := mr.ZScore(schedule, members[0]); score != float64(toMillis(clock.Now().Add(saturatedDelay))) {
+		t.Fatal("saturated notification was not requeued with a delay", score)
+	}
+
+	//其他 worker 仍然可以处理新的通知
+	n.PutNotification(&Entity{Key: "free"})
+	clock.advance(time.Minute)
+	waitFor(t, func() bool {
+		_, ok := handled.Load("free")
+		return ok
+	})
+
+	close(release)
+	clock.advance(saturatedDelay)
+	waitFor(t, func() bool { return sub.Stats().Processed == 4 })
+	if stats := sub.Stats(); stats.Queued != 0 || stats.InFlight != 0 {
+		t.Fatal(stats)
+	}
+}
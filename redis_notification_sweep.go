@@ -0,0 +1,168 @@
+// recovery of notifications whose expiration was missed
+
+package redisplus
+
+import (
+	"errors"
+	"gopkg.in/redis.v5"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//recoverScript 重新认领租约已过期的通知, 原持有者的租约 token 失效
+//KEYS[1] 处理队列 KEYS[2] 租约 token
+//ARGV[1] 当前时间(ms) ARGV[2] 单次数量 ARGV[3] 租约到期时间(ms) ARGV[4] 租约 token
+var recoverScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(expired) do
+	redis.call('ZADD', KEYS[1], ARGV[3], member)
+	redis.call('HSET', KEYS[2], member, ARGV[4])
+end
+return expired
+`)
+
+//sweep 查找 value 仍存在但通知 key 已过期且未被锁定的通知, 返回已被当前节点锁定的通知.
+//没有状态记录的 value(旧版本写入)无法确定重试次数, 不做恢复
+func (k *keyspaceSource) sweep() ([]*Entity, error) {
+	n := k.n
+	var mu sync.Mutex
+	var recovered []*Entity
+	pattern := n.fullKey(NotifyValuePrefix + RedisKeySep + "*")
+	err := scanNodes(n.cache.NativeCmd(), pattern, func(keys []string) error {
+		for _, key := range keys {
+			entity, err := k.orphan(key)
+			if nil != err {
+				n.logger.Error("sweep value", "key", key, "err", err)
+				continue
+			}
+			if entity != nil {
+				mu.Lock()
+				recovered = append(recovered, entity)
+				mu.Unlock()
+			}
+		}
+		return nil
+	})
+	return recovered, err
+}
+
+//scanNodes 扫描匹配 pattern 的 key, 集群模式下并发扫描每个 master 节点, fn 需要自行同步
+func scanNodes(cmd RedisCmd, pattern string, fn func(keys []string) error) error {
+	scan := func(client redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(cursor, pattern, scanCount).Result()
+			if nil != err {
+				return err
+			}
+			if err := fn(keys); nil != err {
+				return err
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if cluster, ok := cmd.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(func(client *redis.Client) error {
+			return scan(client)
+		})
+	}
+	return scan(cmd)
+}
+
+//masterNodes 返回按地址排序的 master 节点, 拓扑不变时顺序固定, 非集群模式下只有一个节点
+func masterNodes(cmd RedisCmd) ([]redis.Cmdable, error) {
+	cluster, ok := cmd.(*redis.ClusterClient)
+	if !ok {
+		return []redis.Cmdable{cmd}, nil
+	}
+	var mu sync.Mutex
+	var clients []*redis.Client
+	err := cluster.ForEachMaster(func(client *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		clients = append(clients, client)
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].String() < clients[j].String()
+	})
+	nodes := make([]redis.Cmdable, len(clients))
+	for i, client := range clients {
+		nodes[i] = client
+	}
+	return nodes, nil
+}
+
+//orphan 判断 value key 对应的通知是否已丢失, 丢失时加锁并返回通知
+func (k *keyspaceSource) orphan(valueKey string) (*Entity, error) {
+	n := k.n
+	parts := strings.Split(valueKey, RedisKeySep)
+	entity, err := parseEntity(parts[len(parts)-1], "0")
+	if nil != err {
+		return nil, err
+	}
+	entity.legacy = isLegacyTag(parts[len(parts)-1])
+	count, err := n.fetchCount(entity)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if nil != err {
+		return nil, err
+	}
+	entity.count = count
+
+	exists, err := n.cache.NativeCmd().Exists(n.fullKey(entity.notifyKey())).Result()
+	if nil != err || exists {
+		return nil, err
+	}
+	locked, err := n.lock(entity)
+	if nil != err || !locked {
+		return nil, err
+	}
+	//检查与加锁之间通知可能已被其他节点完成或重新投递
+	if current, err := n.fetchCount(entity); nil != err || current != count {
+		n.unlock(entity)
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		return nil, err
+	}
+	if entity.legacy {
+		k.migrateLegacy(entity)
+		return nil, nil
+	}
+	return entity, nil
+}
+
+//sweep 重新认领处理超时的通知
+func (s *scheduleSource) sweep() ([]*Entity, error) {
+	n := s.n
+	now := n.clock.Now()
+	token := n.leaseToken()
+	keys := []string{n.fullKey(NotifyProcessingPrefix), n.fullKey(NotifyLeasePrefix)}
+	result, err := recoverScript.Run(n.cache.NativeCmd(), keys,
+		toMillis(now), s.batchSize, toMillis(now.Add(n.lockTTL)), token).Result()
+	if nil != err {
+		return nil, err
+	}
+	members, _ := result.([]interface{})
+	var recovered []*Entity
+	for _, m := range members {
+		member, _ := m.(string)
+		entity, err := decodeMember(member)
+		if nil != err {
+			n.logger.Error("decode member", "member", member, "err", err)
+			continue
+		}
+		entity.token = token
+		recovered = append(recovered, entity)
+	}
+	return recovered, nil
+}
@@ -0,0 +1,105 @@
+package redisplus
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceSweep(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	deliveries := make(chan *Delivery, 4)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		deliveries <- d
+		return Done()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	n.PutNotification(entity)
+	if count, err := sub.Sweep(); err != nil || count != 0 {
+		t.Fatal("swept a pending notification", count, err)
+	}
+
+	//通知 key 已过期但没有收到 expired 事件
+	s.Del(n.fullKey(entity.notifyKey()))
+	if count, err := sub.Sweep(); err != nil || count != 1 {
+		t.Fatal(count, err)
+	}
+	if d := receiveDelivery(t, deliveries); d.Entity.Key != "1" || string(d.Entity.Value) != "v" {
+		t.Fatal(d.Entity)
+	}
+	if stats := sub.Stats(); stats.Recovered != 1 {
+		t.Fatal(stats)
+	}
+
+	//其他节点已锁定的通知不恢复
+	other := &Entity{Key: "2", Value: []byte("v")}
+	n.PutNotification(other)
+	s.Del(n.fullKey(other.notifyKey()))
+	s.Set(n.fullKey(NotifyLockPrefix+RedisKeySep+other.notifyKey()), "other")
+	if count, err := sub.Sweep(); err != nil || count != 0 {
+		t.Fatal("swept a notification locked by another node", count, err)
+	}
+
+	if err := sub.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Sweep(); err != errSubscriptionStopped {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyspaceSweepReleasedOnStop(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		<-ctx.Done()
+		return Done()
+	}, WithWorkers(1), WithQueueSize(1), WithShutdownTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"1", "2", "3"} {
+		entity := &Entity{Key: key, Value: []byte("v")}
+		n.PutNotification(entity)
+		s.Del(n.fullKey(entity.notifyKey()))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sub.Sweep()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	sub.Stop()
+	<-done
+	for _, key := range s.Keys() {
+		if strings.Contains(key, NotifyLockPrefix) {
+			t.Fatal("lock was not released on stop", key)
+		}
+	}
+}
+
+func TestScheduledSweep(t *testing.T) {
+	s, n, clock := newTestScheduled(t)
+	source := &scheduleSource{n: n, batchSize: 10}
+	n.PutNotification(&Entity{Key: "1", Value: []byte("v")})
+	clock.now = clock.now.Add(time.Minute)
+	claimed, _ := n.claim(10)
+
+	if entities, err := source.sweep(); err != nil || len(entities) != 0 {
+		t.Fatal("swept a leased notification", entities, err)
+	}
+	clock.now = clock.now.Add(11 * time.Second)
+	entities, err := source.sweep()
+	if err != nil || len(entities) != 1 || entities[0].member() != claimed[0].member() {
+		t.Fatal(entities, err)
+	}
+	processing := "TEST:dev:{order}:" + NotifyProcessingPrefix
+	if score, _ := s.ZScore(processing, claimed[0].member()); score != float64(toMillis(clock.now.Add(10*time.Second))) {
+		t.Fatal("recovered lease was not renewed", score)
+	}
+}
@@ -1,8 +1,10 @@
 package redisplus
 
 import (
+	"context"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-hclog"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -15,6 +17,9 @@ func TestNewNotification(t *testing.T) {
 	}
 
 	view, _ := NewRedisCli(cfg,"dev")
+	if err := view.NativeCmd().Ping().Err(); err != nil {
+		t.Skip("redis not available:", err)
+	}
 	policies := []time.Duration{
 		time.Second * 10,
 		time.Second * 15,
@@ -22,7 +27,7 @@ func TestNewNotification(t *testing.T) {
 	}
 
 	t.Log(policies)
-	notify, err := NewNotification("order", view, hclog.Default(), policies)
+	notify, err := NewNotification("order", view, WithLogger(hclog.Default()), WithPolicies(policies...))
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -37,12 +42,167 @@ func TestNewNotification(t *testing.T) {
 		Value: []byte("test-notify"),
 	}
 
-	notify.Subscribe(func(p *Entity, err error) PutNext {
+	done := make(chan byte)
+	sub, err := notify.Subscribe(func(p *Entity, err error) PutNext {
 		t.Log(err, p.Key, p.Value, p.valueKey(), p.notifyKey())
-		return p.count == 1
+		if p.count == 1 {
+			close(done)
+		}
+		return p.count == 0
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
 
-	notify.PutNotification(entity)
-	done := make(chan byte)
-	<-done
-}
\ No newline at end of file
+	if err := notify.PutNotification(entity); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("notification not received")
+	}
+}
+//TestSubscriptionStop Stop 关闭 PubSub, 等待处理中的 handler 结束, 并释放排队中的通知锁
+func TestSubscriptionStop(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	started := make(chan *Entity, 2)
+	release := make(chan struct{})
+	var finished int32
+	sub, err := n.Subscribe(func(p *Entity, err error) PutNext {
+		started <- p
+		<-release
+		atomic.StoreInt32(&finished, 1)
+		return false
+	}, WithWorkers(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.PubSubNumPat() > 0 })
+
+	//一个 worker: 一个通知处理中, 另一个已加锁排队
+	n.PutNotification(&Entity{Key: "1", Value: []byte("a")})
+	n.PutNotification(&Entity{Key: "2", Value: []byte("b")})
+	fireNotifications(s)
+	running := <-started
+	waitFor(t, func() bool { return sub.Stats().Queued == 1 })
+	queued := &Entity{Key: "1"}
+	if running.Key == "1" {
+		queued.Key = "2"
+	}
+	lockKey := n.fullKey(NotifyLockPrefix + RedisKeySep + queued.notifyKey())
+	if !s.Exists(lockKey) {
+		t.Fatal("queued notification is not locked")
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- sub.Stop() }()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the in-flight handler finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("in-flight handler did not finish")
+	}
+	if s.Exists(lockKey) {
+		t.Fatal("lock of the queued notification was not released")
+	}
+	if s.PubSubNumPat() != 0 {
+		t.Fatal("PubSub not closed")
+	}
+	sub.Wait()
+	if err := sub.Stop(); err != nil {
+		t.Fatal("second Stop", err)
+	}
+	select {
+	case p := <-started:
+		t.Fatal("handler called after Stop", p)
+	default:
+	}
+}
+
+//TestSubscriptionStopContext Stop 不取消处理中 handler 的 ctx, handler 正常结束而不消耗一次重试
+func TestSubscriptionStopContext(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	results := make(chan error, 1)
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		close(started)
+		select {
+		case <-ctx.Done():
+			results <- ctx.Err()
+			return Retry(ctx.Err())
+		case <-release:
+			results <- nil
+			return Done()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.PubSubNumPat() > 0 })
+	entity := &Entity{Key: "1", Value: []byte("v")}
+	n.PutNotification(entity)
+	fireNotifications(s)
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- sub.Stop() }()
+	waitFor(t, func() bool { return s.PubSubNumPat() == 0 })
+	select {
+	case err := <-results:
+		t.Fatal("Stop cancelled the in-flight handler", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Keys()) != 0 {
+		t.Fatal("handler result was not applied", s.Keys())
+	}
+}
+
+//TestSubscriptionShutdownTimeout Stop 超过 WithShutdownTimeout 后取消 handler 的 ctx
+func TestSubscriptionShutdownTimeout(t *testing.T) {
+	s, n := newTestKeyspace(t)
+	started := make(chan struct{})
+	sub, err := n.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		close(started)
+		<-ctx.Done()
+		return Retry(ctx.Err())
+	}, WithShutdownTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.PubSubNumPat() > 0 })
+	n.PutNotification(&Entity{Key: "1", Value: []byte("v")})
+	fireNotifications(s)
+	<-started
+
+	begin := time.Now()
+	if err := sub.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatal("Stop did not wait for the shutdown timeout", elapsed)
+	}
+	if p, err := n.Get("1"); err != nil || p.Count != 1 {
+		t.Fatal("cancelled handler was not retried", p, err)
+	}
+}
@@ -0,0 +1,104 @@
+// typed notification payloads with pluggable codec
+
+package redisplus
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec 通知 value 的编解码器, msgpack/proto 等实现同样的接口即可使用
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec 使用 encoding/json 编解码
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec 使用 encoding/gob 编解码
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// TypedDelivery 带有解码后 value 的通知触发上下文
+type TypedDelivery[T any] struct {
+	*Delivery
+	Value T
+}
+
+// TypedHandler 类型化的通知处理函数
+type TypedHandler[T any] func(ctx context.Context, d *TypedDelivery[T]) Result
+
+// TypedNotification 以 T 作为通知 value 的 Notification 封装
+type TypedNotification[T any] struct {
+	Notification
+	codec Codec
+}
+
+// NewTypedNotification 使用 codec 编解码 T, codec 为空时使用 JSONCodec
+func NewTypedNotification[T any](n Notification, codec Codec) *TypedNotification[T] {
+	if nil == codec {
+		codec = JSONCodec{}
+	}
+	return &TypedNotification[T]{Notification: n, codec: codec}
+}
+
+// Put 编码 value 并投递通知
+func (t *TypedNotification[T]) Put(key string, value T) error {
+	bs, err := t.codec.Marshal(value)
+	if nil != err {
+		return err
+	}
+	return t.PutNotification(&Entity{Key: key, Value: bs})
+}
+
+// Decode 解码通知的 value
+func (t *TypedNotification[T]) Decode(p *Entity) (T, error) {
+	var value T
+	err := t.codec.Unmarshal(p.Value, &value)
+	return value, err
+}
+
+// SubscribeTyped 订阅通知并将 value 解码为 T 交给 handler.
+// value 读取或解码失败的通知交给 onError, Delivery.Err 为失败原因;
+// onError 为空时直接移入死信
+func (t *TypedNotification[T]) SubscribeTyped(handler TypedHandler[T], onError DeliveryHandler, opts ...SubscribeOption) (Subscription, error) {
+	return t.SubscribeDelivery(func(ctx context.Context, d *Delivery) Result {
+		if nil == d.Err {
+			value, err := t.Decode(d.Entity)
+			if nil == err {
+				return handler(ctx, &TypedDelivery[T]{Delivery: d, Value: value})
+			}
+			//只有 codec 返回的错误计为解码失败, 读取 value 失败不计入
+			d.Err = err
+			if nil != d.n {
+				d.n.observer.Observe(d.n.prefix, EventDecodeFailed)
+			}
+		}
+		if nil == onError {
+			return ToDeadLetter(d.Err)
+		}
+		return onError(ctx, d)
+	}, opts...)
+}
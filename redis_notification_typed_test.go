@@ -0,0 +1,105 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type order struct {
+	ID     string
+	Amount int
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	for name, codec := range map[string]Codec{"json": nil, "gob": GobCodec{}} {
+		t.Run(name, func(t *testing.T) {
+			_, n, clock := newTestScheduled(t)
+			typed := NewTypedNotification[order](n, codec)
+			want := order{ID: "o-1", Amount: 42}
+			if err := typed.Put("o-1", want); err != nil {
+				t.Fatal(err)
+			}
+			clock.advance(time.Minute)
+
+			deliveries := make(chan *TypedDelivery[order], 1)
+			sub, err := typed.SubscribeTyped(func(ctx context.Context, d *TypedDelivery[order]) Result {
+				deliveries <- d
+				return Done()
+			}, nil, WithPollInterval(10*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Stop()
+			select {
+			case d := <-deliveries:
+				if d.Value != want || d.Entity.Key != "o-1" || d.Attempt != 0 {
+					t.Fatal(d.Value, d.Entity)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("typed notification not received")
+			}
+		})
+	}
+}
+
+func TestTypedBadPayload(t *testing.T) {
+	observer := NewMetricsObserver()
+	s, n, clock := newTestScheduled(t, WithObserver(observer))
+	typed := NewTypedNotification[order](n, JSONCodec{})
+	decodeFailed := func() uint64 {
+		observer.mu.Lock()
+		defer observer.mu.Unlock()
+		return observer.events[eventLabels{"order", EventDecodeFailed}]
+	}
+
+	//value 不是合法的 JSON, 没有 onError 时移入死信
+	n.PutNotification(&Entity{Key: "bad", Value: []byte("not json")})
+	clock.advance(time.Minute)
+	sub, err := typed.SubscribeTyped(func(ctx context.Context, d *TypedDelivery[order]) Result {
+		t.Error("handler called with a bad payload", d.Entity)
+		return Done()
+	}, nil, WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var letter *DeadLetter
+	waitFor(t, func() bool {
+		letter, _ = n.DeadLetter("bad")
+		return letter != nil
+	})
+	sub.Stop()
+	if string(letter.Value) != "not json" || letter.LastError == "" || decodeFailed() != 1 {
+		t.Fatal("dead letter", letter, decodeFailed())
+	}
+
+	//读取 value 失败交给 onError, 不计为解码失败
+	entity := &Entity{Key: "missing", Value: []byte(`{"ID":"o-2"}`)}
+	n.PutNotification(entity)
+	s.Del(n.fullKey(entity.valueKey()))
+	clock.advance(time.Minute)
+	failures := make(chan error, 1)
+	sub, err = typed.SubscribeTyped(func(ctx context.Context, d *TypedDelivery[order]) Result {
+		t.Error("handler called without a value", d.Entity)
+		return Done()
+	}, func(ctx context.Context, d *Delivery) Result {
+		failures <- d.Err
+		return Done()
+	}, WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+	select {
+	case err := <-failures:
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("onError not called")
+	}
+	if decodeFailed() != 1 {
+		t.Fatal("fetch failure counted as a decode failure", decodeFailed())
+	}
+}
@@ -0,0 +1,236 @@
+// reliable queue on lists with per-consumer processing lists
+
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/redis.v5"
+	"strconv"
+	"time"
+)
+
+// QueueProcessingSuffix 消费者处理中列表的后缀, 完整 key 为 {queue}:PROCESSING:<consumer>
+const QueueProcessingSuffix = "PROCESSING"
+
+// QueueConsumersSuffix 消费者心跳 zset 的后缀, score 为心跳过期时间(ms)
+const QueueConsumersSuffix = "CONSUMERS"
+
+// defaultVisibilityTimeout 消费者超过该时间没有心跳时, 处理中的元素回到队列
+const defaultVisibilityTimeout = time.Second * 30
+
+// minVisibilityTimeout 阻塞消费期间每 blockingStep 心跳一次, 需要留出余量
+const minVisibilityTimeout = blockingStep * 2
+
+var errConsumerNotNil = errors.New("consumer must be not null")
+var errVisibilityTimeout = errors.New("visibility timeout must be at least 2s")
+var errReapInterval = errors.New("reap interval must be positive")
+
+//nackScript 从处理中列表移除元素并放回队列的消费端
+//KEYS[1] 队列 KEYS[2] 处理中列表
+//ARGV[1] 元素
+var nackScript = redis.NewScript(`
+if redis.call('LREM', KEYS[2], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+return 1
+`)
+
+//reapScript 消费者心跳已过期时, 将处理中的元素按原顺序放回队列的消费端
+//KEYS[1] 队列 KEYS[2] 处理中列表 KEYS[3] 消费者心跳
+//ARGV[1] 消费者 ARGV[2] 当前时间(ms)
+var reapScript = redis.NewScript(`
+local deadline = redis.call('ZSCORE', KEYS[3], ARGV[1])
+if deadline and tonumber(deadline) > tonumber(ARGV[2]) then
+	return 0
+end
+local count = 0
+while true do
+	local value = redis.call('LPOP', KEYS[2])
+	if not value then
+		break
+	end
+	redis.call('RPUSH', KEYS[1], value)
+	count = count + 1
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+return count
+`)
+
+// QueueOption 创建队列的可选配置
+type QueueOption func(q *ReliableQueue) error
+
+// WithVisibilityTimeout 设置消费者心跳的有效期, 默认 30s
+func WithVisibilityTimeout(timeout time.Duration) QueueOption {
+	return func(q *ReliableQueue) error {
+		if timeout < minVisibilityTimeout {
+			return errVisibilityTimeout
+		}
+		q.visibility = timeout
+		return nil
+	}
+}
+
+// ReliableQueue 基于 list 的可靠队列. 元素被消费时原子地移动到消费者的处理中列表,
+// Ack 后删除, Nack 后放回队列; 消费者超过 visibility timeout 没有心跳时, 由 Reap 放回队列.
+// 所有 key 使用同一个 hash tag, 集群模式下在同一个 slot
+type ReliableQueue struct {
+	cache      RedisCli
+	key        string //完整的队列 key
+	consumers  string //完整的消费者心跳 key
+	visibility time.Duration
+	clock      Clock
+}
+
+// NewReliableQueue 创建可靠队列, name 不包含前缀
+func NewReliableQueue(cache RedisCli, name string, opts ...QueueOption) (*ReliableQueue, error) {
+	full := cache.KeyPrefix() + RedisKeySep + name
+	q := &ReliableQueue{
+		cache:      cache,
+		key:        full,
+		consumers:  companionKey(full, QueueConsumersSuffix),
+		visibility: defaultVisibilityTimeout,
+		clock:      systemClock{},
+	}
+	for _, opt := range opts {
+		if err := opt(q); nil != err {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+//processingKey 消费者的处理中列表
+func (q *ReliableQueue) processingKey(consumer string) string {
+	return companionKey(q.key, QueueProcessingSuffix+RedisKeySep+consumer)
+}
+
+// Push 写入元素, 先写入的先被消费
+func (q *ReliableQueue) Push(values ...[]byte) (int64, error) {
+	var in []interface{}
+	for _, value := range values {
+		in = append(in, value)
+	}
+	result, err := q.cache.NativeCmd().LPush(q.key, in...).Result()
+	if nil != err {
+		return 0, wrapError("lpush", q.key, err)
+	}
+	return result, nil
+}
+
+// Len 返回等待消费的元素数量
+func (q *ReliableQueue) Len() (int64, error) {
+	result, err := q.cache.NativeCmd().LLen(q.key).Result()
+	if nil != err {
+		return 0, wrapError("llen", q.key, err)
+	}
+	return result, nil
+}
+
+// Consume 阻塞直到取得元素或 ctx 结束, 元素移动到消费者的处理中列表.
+// 处理时间可能超过 visibility timeout 时, 需要定期调用 Heartbeat
+func (q *ReliableQueue) Consume(ctx context.Context, consumer string) ([]byte, error) {
+	if "" == consumer {
+		return nil, errConsumerNotNil
+	}
+	processing := q.processingKey(consumer)
+	var value []byte
+	err := blockingCall(ctx, func() (err error) {
+		if err = q.Heartbeat(consumer); nil != err {
+			return err
+		}
+		value, err = q.cache.NativeCmd().BRPopLPush(q.key, processing, blockingStep).Bytes()
+		return err
+	})
+	if nil != err {
+		return nil, wrapError("brpoplpush", q.key, err)
+	}
+	if err := q.Heartbeat(consumer); nil != err {
+		return value, err
+	}
+	return value, nil
+}
+
+// Heartbeat 延长消费者的有效期
+func (q *ReliableQueue) Heartbeat(consumer string) error {
+	if "" == consumer {
+		return errConsumerNotNil
+	}
+	deadline := float64(toMillis(q.clock.Now().Add(q.visibility)))
+	err := q.cache.NativeCmd().ZAdd(q.consumers, redis.Z{Score: deadline, Member: consumer}).Err()
+	return wrapError("zadd", q.consumers, err)
+}
+
+// Ack 处理完成, 从处理中列表删除元素, 元素不存在时返回 false
+func (q *ReliableQueue) Ack(consumer string, value []byte) (bool, error) {
+	processing := q.processingKey(consumer)
+	count, err := q.cache.NativeCmd().LRem(processing, 1, value).Result()
+	if nil != err {
+		return false, wrapError("lrem", processing, err)
+	}
+	return count == 1, nil
+}
+
+// Nack 处理失败, 元素放回队列并优先被消费, 元素不存在时返回 false
+func (q *ReliableQueue) Nack(consumer string, value []byte) (bool, error) {
+	processing := q.processingKey(consumer)
+	ret, err := nackScript.Run(q.cache.NativeCmd(), []string{q.key, processing}, value).Result()
+	if nil != err {
+		return false, wrapError("nack", processing, err)
+	}
+	return ret == int64(1), nil
+}
+
+// Pending 返回消费者处理中的元素, 最新取得的在前
+func (q *ReliableQueue) Pending(consumer string) ([][]byte, error) {
+	processing := q.processingKey(consumer)
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
+		return q.cache.NativeCmd().LRange(processing, 0, -1).Result()
+	})
+	if nil != err {
+		return nil, wrapError("lrange", processing, err)
+	}
+	return result, nil
+}
+
+// Reap 将心跳已过期的消费者处理中的元素放回队列, 返回放回的数量
+func (q *ReliableQueue) Reap() (int64, error) {
+	now := toMillis(q.clock.Now())
+	dead, err := q.cache.NativeCmd().ZRangeByScore(q.consumers, redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now, 10),
+	}).Result()
+	if nil != err {
+		return 0, wrapError("zrangebyscore", q.consumers, err)
+	}
+	var total int64
+	for _, consumer := range dead {
+		keys := []string{q.key, q.processingKey(consumer), q.consumers}
+		ret, err := reapScript.Run(q.cache.NativeCmd(), keys, consumer, now).Result()
+		if nil != err {
+			return total, wrapError("reap", q.processingKey(consumer), err)
+		}
+		count, _ := ret.(int64)
+		total += count
+	}
+	return total, nil
+}
+
+// ReapEvery 每隔 interval 执行一次 Reap, 返回停止的函数
+func (q *ReliableQueue) ReapEvery(interval time.Duration, logger Logger) (func(), error) {
+	if interval <= 0 {
+		return nil, errReapInterval
+	}
+	if nil == logger {
+		logger = nopLogger{}
+	}
+	return runEvery(interval, func() {
+		count, err := q.Reap()
+		if nil != err {
+			logger.Error("reap dead consumers error", "queue", q.key, "error", err.Error())
+		} else if count > 0 {
+			logger.Info("requeued items of dead consumers", "queue", q.key, "count", count)
+		}
+	}), nil
+}
@@ -1,7 +1,16 @@
 package redisplus
 
+import (
+	"gopkg.in/redis.v5"
+	"strings"
+)
+
 func (r *redisView) SLen(key string) (int64, error) {
-	return r.cmd.SCard(r.expandKey(key)).Result()
+	result, err := r.cmd.SCard(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("scard", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) SAdd(key string, values ...[]byte) (int64, error) {
@@ -9,7 +18,11 @@ func (r *redisView) SAdd(key string, values ...[]byte) (int64, error) {
 	for _, value := range values {
 		in = append(in, value)
 	}
-	return r.cmd.SAdd(r.expandKey(key), in...).Result()
+	result, err := r.cmd.SAdd(r.expandKey(key), in...).Result()
+	if nil != err {
+		return 0, wrapError("sadd", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) SRem(key string, values ...[]byte) (int64, error) {
@@ -17,74 +30,154 @@ func (r *redisView) SRem(key string, values ...[]byte) (int64, error) {
 	for _, value := range values {
 		in = append(in, value)
 	}
-	return r.cmd.SRem(r.expandKey(key), in...).Result()
+	result, err := r.cmd.SRem(r.expandKey(key), in...).Result()
+	if nil != err {
+		return 0, wrapError("srem", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) SPop(key string) ([]byte, error) {
 	result, err := r.cmd.SPop(r.expandKey(key)).Result()
 	if nil != err {
-		return nil, err
+		return nil, wrapError("spop", r.expandKey(key), err)
 	}
 	return []byte(result), nil
 }
 
 func (r *redisView) SPopN(key string, count int64) ([][]byte, error) {
-	return wrapSliceStringToSliceBytes(func() ([]string, error) {
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
 		return r.cmd.SPopN(r.expandKey(key), count).Result()
 	})
+	if nil != err {
+		return nil, wrapError("spop", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
-func (r *redisView) SDiff(keys ...string) ([][]byte, error) {
-	var inkeys []string
-	for _, key := range keys {
-		inkeys = append(inkeys, r.expandKey(key))
+func (r *redisView) SMembers(key string) ([][]byte, error) {
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
+		return r.cmd.SMembers(r.expandKey(key)).Result()
+	})
+	if nil != err {
+		return nil, wrapError("smembers", r.expandKey(key), err)
 	}
+	return result, nil
+}
 
-	return wrapSliceStringToSliceBytes(func() ([]string, error) {
-		return r.cmd.SDiff(inkeys...).Result()
+func (r *redisView) SIsMember(key string, member []byte) (bool, error) {
+	result, err := r.cmd.SIsMember(r.expandKey(key), member).Result()
+	if nil != err {
+		return false, wrapError("sismember", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// SMIsMember 按 members 的顺序返回是否存在, 需要 redis 6.2
+func (r *redisView) SMIsMember(key string, members ...[]byte) ([]bool, error) {
+	args := []interface{}{"smismember", r.expandKey(key)}
+	for _, member := range members {
+		args = append(args, member)
+	}
+	cmd := redis.NewBoolSliceCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("smismember", r.expandKey(key), err)
+	}
+	result, err := cmd.Result()
+	if nil != err {
+		return nil, wrapError("smismember", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// SRandMember 随机返回 count 个 member, count 为负数时允许重复
+func (r *redisView) SRandMember(key string, count int64) ([][]byte, error) {
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
+		return r.cmd.SRandMemberN(r.expandKey(key), count).Result()
 	})
+	if nil != err {
+		return nil, wrapError("srandmember", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
-func (r *redisView) SDiffMerge(destination string, keys ...string) (int64, error) {
-	var inkeys []string
-	for _, key := range keys {
-		inkeys = append(inkeys, r.expandKey(key))
+// SMove destination 与 source 使用相同的前缀, 集群模式下必须在同一个 slot
+func (r *redisView) SMove(source, destination string, member []byte) (bool, error) {
+	from, to := r.expandKey(source), r.expandKey(destination)
+	if err := r.sameSlot(from, to); err != nil {
+		return false, err
 	}
-	return r.cmd.SDiffStore(destination, inkeys...).Result()
+	result, err := r.cmd.SMove(from, to, member).Result()
+	if nil != err {
+		return false, wrapError("smove", from, err)
+	}
+	return result, nil
 }
 
-func (r *redisView) SInter(keys ...string) ([][]byte, error) {
-	var inkeys []string
-	for _, key := range keys {
-		inkeys = append(inkeys, r.expandKey(key))
+// SScan match 匹配 member, 返回的 cursor 为 0 时遍历结束
+func (r *redisView) SScan(key string, cursor uint64, match string, count int64) ([][]byte, uint64, error) {
+	members, next, err := r.cmd.SScan(r.expandKey(key), cursor, match, count).Result()
+	if nil != err {
+		return nil, 0, wrapError("sscan", r.expandKey(key), err)
 	}
-	return wrapSliceStringToSliceBytes(func() ([]string, error) {
-		return r.cmd.SInter(inkeys...).Result()
-	})
+	out := make([][]byte, 0, len(members))
+	for _, member := range members {
+		out = append(out, []byte(member))
+	}
+	return out, next, nil
+}
+
+func (r *redisView) SDiff(keys ...string) ([][]byte, error) {
+	return r.setOp("sdiff", keys, r.cmd.SDiff)
 }
 
+// SDiffMerge destination 与 keys 使用相同的前缀, 集群模式下必须在同一个 slot
+func (r *redisView) SDiffMerge(destination string, keys ...string) (int64, error) {
+	return r.setStore("sdiffstore", destination, keys, r.cmd.SDiffStore)
+}
+
+func (r *redisView) SInter(keys ...string) ([][]byte, error) {
+	return r.setOp("sinter", keys, r.cmd.SInter)
+}
+
+// SInterMerge destination 与 keys 使用相同的前缀, 集群模式下必须在同一个 slot
 func (r *redisView) SInterMerge(destination string, keys ...string) (int64, error) {
-	var inkeys []string
-	for _, key := range keys {
-		inkeys = append(inkeys, r.expandKey(key))
-	}
-	return r.cmd.SInterStore(destination, keys...).Result()
+	return r.setStore("sinterstore", destination, keys, r.cmd.SInterStore)
 }
 
 func (r *redisView) SUnion(keys ...string) ([][]byte, error) {
-	var inkeys []string
-	for _, key := range keys {
-		inkeys = append(inkeys, r.expandKey(key))
+	return r.setOp("sunion", keys, r.cmd.SUnion)
+}
+
+// SUnionMerge destination 与 keys 使用相同的前缀, 集群模式下必须在同一个 slot
+func (r *redisView) SUnionMerge(destination string, keys ...string) (int64, error) {
+	return r.setStore("sunionstore", destination, keys, r.cmd.SUnionStore)
+}
+
+//setOp 执行 SDIFF/SINTER/SUNION
+func (r *redisView) setOp(command string, keys []string, call func(keys ...string) *redis.StringSliceCmd) ([][]byte, error) {
+	inKeys := r.expandKeys(keys)
+	if err := r.sameSlot(inKeys...); err != nil {
+		return nil, err
 	}
-	return wrapSliceStringToSliceBytes(func() ([]string, error) {
-		return r.cmd.SUnion(inkeys...).Result()
+	result, err := wrapSliceStringToSliceBytes(func() ([]string, error) {
+		return call(inKeys...).Result()
 	})
+	if nil != err {
+		return nil, wrapError(command, strings.Join(inKeys, " "), err)
+	}
+	return result, nil
 }
 
-func (r *redisView) SUnionMerge(destination string, keys ...string) (int64, error) {
-	var inkeys []string
-	for _, key := range keys {
-		inkeys = append(inkeys, r.expandKey(key))
+//setStore 执行 SDIFFSTORE/SINTERSTORE/SUNIONSTORE
+func (r *redisView) setStore(command, destination string, keys []string, call func(destination string, keys ...string) *redis.IntCmd) (int64, error) {
+	dest, inKeys := r.expandKey(destination), r.expandKeys(keys)
+	if err := r.sameSlot(append([]string{dest}, inKeys...)...); err != nil {
+		return 0, err
+	}
+	result, err := call(dest, inKeys...).Result()
+	if nil != err {
+		return 0, wrapError(command, dest, err)
 	}
-	return r.cmd.SUnionStore(destination, inkeys...).Result()
+	return result, nil
 }
@@ -0,0 +1,75 @@
+package redisplus
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSetMerge(t *testing.T) {
+	cases := []struct {
+		name  string
+		merge func(view RedisCli) (int64, error)
+		want  []string
+	}{
+		{"diff", func(view RedisCli) (int64, error) { return view.SDiffMerge("dest", "a", "b") }, []string{"1"}},
+		{"inter", func(view RedisCli) (int64, error) { return view.SInterMerge("dest", "a", "b") }, []string{"2"}},
+		{"union", func(view RedisCli) (int64, error) { return view.SUnionMerge("dest", "a", "b") }, []string{"1", "2", "3"}},
+	}
+	for _, c := range cases {
+		s, view := newTestView(t)
+		view.SAdd("a", []byte("1"), []byte("2"))
+		view.SAdd("b", []byte("2"), []byte("3"))
+
+		n, err := c.merge(view)
+		if err != nil || n != int64(len(c.want)) {
+			t.Fatalf("%s: %d %v", c.name, n, err)
+		}
+		keys := s.Keys()
+		sort.Strings(keys)
+		if want := []string{"TEST:dev:a", "TEST:dev:b", "TEST:dev:dest"}; !reflect.DeepEqual(keys, want) {
+			t.Fatalf("%s: touched %v, want %v", c.name, keys, want)
+		}
+		members, _ := s.Members("TEST:dev:dest")
+		if !reflect.DeepEqual(members, c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, members, c.want)
+		}
+	}
+}
+
+func TestSetMembers(t *testing.T) {
+	s, view := newTestView(t)
+	view.SAdd("a", []byte("x"), []byte("y"))
+
+	members, err := view.SMembers("a")
+	if err != nil || len(members) != 2 {
+		t.Fatal(members, err)
+	}
+	if ok, err := view.SIsMember("a", []byte("x")); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	exists, err := view.SMIsMember("a", []byte("y"), []byte("z"))
+	if err != nil || !reflect.DeepEqual(exists, []bool{true, false}) {
+		t.Fatal(exists, err)
+	}
+	random, err := view.SRandMember("a", -3)
+	if err != nil || len(random) != 3 {
+		t.Fatal(random, err)
+	}
+	members, cursor, err := view.SScan("a", 0, "x*", 10)
+	if err != nil || cursor != 0 || len(members) != 1 || string(members[0]) != "x" {
+		t.Fatal(members, cursor, err)
+	}
+
+	if ok, err := view.SMove("a", "b", []byte("x")); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	keys := s.Keys()
+	sort.Strings(keys)
+	if want := []string{"TEST:dev:a", "TEST:dev:b"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("touched %v, want %v", keys, want)
+	}
+	if ok, _ := s.IsMember("TEST:dev:b", "x"); !ok {
+		t.Fatal(s.Members("TEST:dev:b"))
+	}
+}
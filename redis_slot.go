@@ -0,0 +1,82 @@
+package redisplus
+
+import (
+	"errors"
+	"strings"
+)
+
+// redisClusterSlots redis cluster 的 hash slot 数量
+const redisClusterSlots = 16384
+
+var ErrCrossSlot = errors.New("keys must be in the same cluster slot")
+
+var crc16Table [256]uint16
+
+func init() {
+	//CRC16-CCITT (XMODEM), 多项式 0x1021
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+// KeySlot 返回完整 key 所在的 cluster slot, key 中包含 {tag} 时只计算 tag
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % redisClusterSlots)
+}
+
+//groupBySlot 按 slot 对完整 key 分组, 返回每组 key 在原切片中的下标.
+//非集群模式下所有 key 为一组
+func (r *redisView) groupBySlot(keys []string) [][]int {
+	if !r.cluster {
+		all := make([]int, len(keys))
+		for i := range keys {
+			all[i] = i
+		}
+		return [][]int{all}
+	}
+	var groups [][]int
+	slots := make(map[int]int)
+	for i, key := range keys {
+		slot := KeySlot(key)
+		idx, ok := slots[slot]
+		if !ok {
+			idx = len(groups)
+			slots[slot] = idx
+			groups = append(groups, nil)
+		}
+		groups[idx] = append(groups[idx], i)
+	}
+	return groups
+}
+
+//companionKey 返回与完整 key 在同一个 slot 的辅助 key.
+//key 已包含有效的 {tag} 时直接追加后缀, 否则使用整个 key 作为 tag
+func companionKey(full, suffix string) string {
+	if start := strings.IndexByte(full, '{'); start >= 0 {
+		if end := strings.IndexByte(full[start+1:], '}'); end > 0 {
+			return full + RedisKeySep + suffix
+		}
+	}
+	return "{" + full + "}" + RedisKeySep + suffix
+}
@@ -0,0 +1,265 @@
+package redisplus
+
+import (
+	"gopkg.in/redis.v5"
+	"strings"
+	"time"
+)
+
+func (r *redisView) Incr(key string) (int64, error) {
+	result, err := r.cmd.Incr(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("incr", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) IncrBy(key string, value int64) (int64, error) {
+	result, err := r.cmd.IncrBy(r.expandKey(key), value).Result()
+	if nil != err {
+		return 0, wrapError("incrby", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) IncrByFloat(key string, value float64) (float64, error) {
+	result, err := r.cmd.IncrByFloat(r.expandKey(key), value).Result()
+	if nil != err {
+		return 0, wrapError("incrbyfloat", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) Decr(key string) (int64, error) {
+	result, err := r.cmd.Decr(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("decr", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) DecrBy(key string, value int64) (int64, error) {
+	result, err := r.cmd.DecrBy(r.expandKey(key), value).Result()
+	if nil != err {
+		return 0, wrapError("decrby", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// MGet 不存在的 key 对应的结果为 nil, 集群模式下按 slot 拆分执行
+func (r *redisView) MGet(keys ...string) ([][]byte, error) {
+	all := make([]string, 0, len(keys))
+	for _, key := range keys {
+		all = append(all, r.expandKey(key))
+	}
+	out := make([][]byte, len(keys))
+	for _, group := range r.groupBySlot(all) {
+		slotKeys := make([]string, 0, len(group))
+		for _, idx := range group {
+			slotKeys = append(slotKeys, all[idx])
+		}
+		result, err := r.cmd.MGet(slotKeys...).Result()
+		if nil != err {
+			return nil, wrapError("mget", strings.Join(slotKeys, " "), err)
+		}
+		for i, value := range result {
+			if s, ok := value.(string); ok {
+				out[group[i]] = []byte(s)
+			}
+		}
+	}
+	return out, nil
+}
+
+// MSet 集群模式下按 slot 拆分执行, 不同 slot 之间不保证原子性
+func (r *redisView) MSet(values map[string][]byte) error {
+	if nil == values {
+		return ErrorInputValuesIsNil
+	}
+	keys, pairs := r.expandPairs(values)
+	for _, group := range r.groupBySlot(keys) {
+		var slotKeys []string
+		var slotPairs []interface{}
+		for _, idx := range group {
+			slotKeys = append(slotKeys, keys[idx])
+			slotPairs = append(slotPairs, pairs[idx*2], pairs[idx*2+1])
+		}
+		err := wrapResult(func() (interface{}, error) {
+			return r.cmd.MSet(slotPairs...).Result()
+		})
+		if nil != err {
+			return wrapError("mset", strings.Join(slotKeys, " "), err)
+		}
+	}
+	return nil
+}
+
+// MSetNX 所有 key 都不存在时才写入, 集群模式下所有 key 必须在同一个 slot
+func (r *redisView) MSetNX(values map[string][]byte) (bool, error) {
+	if nil == values {
+		return false, ErrorInputValuesIsNil
+	}
+	keys, pairs := r.expandPairs(values)
+	if len(r.groupBySlot(keys)) > 1 {
+		return false, ErrCrossSlot
+	}
+	result, err := r.cmd.MSetNX(pairs...).Result()
+	if nil != err {
+		return false, wrapError("msetnx", strings.Join(keys, " "), err)
+	}
+	return result, nil
+}
+
+//expandPairs 展开 key 并转换为 MSET 参数
+func (r *redisView) expandPairs(values map[string][]byte) ([]string, []interface{}) {
+	keys := make([]string, 0, len(values))
+	pairs := make([]interface{}, 0, len(values)*2)
+	for key, value := range values {
+		full := r.expandKey(key)
+		keys = append(keys, full)
+		pairs = append(pairs, full, value)
+	}
+	return keys, pairs
+}
+
+func (r *redisView) GetSet(key string, value []byte) ([]byte, error) {
+	result, err := r.cmd.GetSet(r.expandKey(key), value).Result()
+	if nil != err {
+		return nil, wrapError("getset", r.expandKey(key), err)
+	}
+	return []byte(result), nil
+}
+
+// GetDel 需要 redis 6.2
+func (r *redisView) GetDel(key string) ([]byte, error) {
+	cmd := redis.NewStringCmd("getdel", r.expandKey(key))
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("getdel", r.expandKey(key), err)
+	}
+	result, err := cmd.Bytes()
+	if nil != err {
+		return nil, wrapError("getdel", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// GetEx 读取 value 并设置过期时间, duration 为空时不修改过期时间, 需要 redis 6.2
+// Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+func (r *redisView) GetEx(key string, duration string) ([]byte, error) {
+	var timeout time.Duration
+	if duration != "" {
+		var err error
+		if timeout, err = time.ParseDuration(duration); err != nil {
+			return nil, err
+		}
+	}
+	return r.GetExDuration(key, timeout)
+}
+
+// GetExDuration 读取 value 并设置过期时间, ttl 为 0 时不修改过期时间, 为负数时返回错误,
+// 不足 1ms 时按 1ms 处理, 需要 redis 6.2
+func (r *redisView) GetExDuration(key string, ttl time.Duration) ([]byte, error) {
+	if ttl < 0 {
+		return nil, ErrorDurationNegative
+	}
+	args := []interface{}{"getex", r.expandKey(key)}
+	if ttl > 0 {
+		px := int64(ttl / time.Millisecond)
+		if px < 1 {
+			px = 1
+		}
+		args = append(args, "px", px)
+	}
+	return r.getEx(key, args...)
+}
+
+// GetExPersist 读取 value 并移除过期时间, 需要 redis 6.2
+func (r *redisView) GetExPersist(key string) ([]byte, error) {
+	return r.getEx(key, "getex", r.expandKey(key), "persist")
+}
+
+func (r *redisView) getEx(key string, args ...interface{}) ([]byte, error) {
+	cmd := redis.NewStringCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("getex", r.expandKey(key), err)
+	}
+	result, err := cmd.Bytes()
+	if nil != err {
+		return nil, wrapError("getex", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) Append(key string, value []byte) (int64, error) {
+	result, err := r.cmd.Append(r.expandKey(key), string(value)).Result()
+	if nil != err {
+		return 0, wrapError("append", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) GetRange(key string, start, end int64) ([]byte, error) {
+	result, err := r.cmd.GetRange(r.expandKey(key), start, end).Result()
+	if nil != err {
+		return nil, wrapError("getrange", r.expandKey(key), err)
+	}
+	return []byte(result), nil
+}
+
+func (r *redisView) SetRange(key string, offset int64, value []byte) (int64, error) {
+	result, err := r.cmd.SetRange(r.expandKey(key), offset, string(value)).Result()
+	if nil != err {
+		return 0, wrapError("setrange", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+func (r *redisView) StrLen(key string) (int64, error) {
+	result, err := r.cmd.StrLen(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("strlen", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// SetXX 只在 key 已存在时写入
+// Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+func (r *redisView) SetXX(key string, value []byte, duration string) (bool, error) {
+	timeout, err := r.parseTTL(duration)
+	if nil != err {
+		return false, err
+	}
+	return r.SetXXDuration(key, value, timeout)
+}
+
+func (r *redisView) SetXXDuration(key string, value []byte, ttl time.Duration) (bool, error) {
+	timeout, err := r.ttlOrDefault(ttl)
+	if nil != err {
+		return false, err
+	}
+	return r.setXX(key, value, timeout)
+}
+
+// SetXXNoTTL 只在 key 已存在时写入, 写入后 key 不过期, 不使用默认过期时间
+func (r *redisView) SetXXNoTTL(key string, value []byte) (bool, error) {
+	return r.setXX(key, value, 0)
+}
+
+func (r *redisView) setXX(key string, value []byte, ttl time.Duration) (bool, error) {
+	result, err := r.cmd.SetXX(r.expandKey(key), value, ttl).Result()
+	if nil != err {
+		return false, wrapError("setxx", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// SetKeepTTL 写入 value 并保留原有的过期时间, 需要 redis 6.0
+func (r *redisView) SetKeepTTL(key string, value []byte) error {
+	cmd := redis.NewStatusCmd("set", r.expandKey(key), value, "keepttl")
+	if err := r.cmd.Process(cmd); err != nil {
+		return wrapError("set", r.expandKey(key), err)
+	}
+	return wrapError("set", r.expandKey(key), wrapResult(func() (interface{}, error) {
+		return cmd.Result()
+	}))
+}
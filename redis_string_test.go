@@ -0,0 +1,123 @@
+package redisplus
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStringCounters(t *testing.T) {
+	_, view := newTestView(t)
+	cases := []struct {
+		name string
+		call func() (int64, error)
+		want int64
+	}{
+		{"incr", func() (int64, error) { return view.Incr("n") }, 1},
+		{"incrby", func() (int64, error) { return view.IncrBy("n", 10) }, 11},
+		{"decr", func() (int64, error) { return view.Decr("n") }, 10},
+		{"decrby", func() (int64, error) { return view.DecrBy("n", 4) }, 6},
+		{"append", func() (int64, error) { return view.Append("s", []byte("hello")) }, 5},
+		{"setrange", func() (int64, error) { return view.SetRange("s", 5, []byte(" world")) }, 11},
+		{"strlen", func() (int64, error) { return view.StrLen("s") }, 11},
+		{"strlen missing", func() (int64, error) { return view.StrLen("none") }, 0},
+	}
+	for _, c := range cases {
+		got, err := c.call()
+		if err != nil || got != c.want {
+			t.Fatalf("%s: got %d %v, want %d", c.name, got, err, c.want)
+		}
+	}
+	if f, err := view.IncrByFloat("f", 1.5); err != nil || f != 1.5 {
+		t.Fatal(f, err)
+	}
+	if value, err := view.GetRange("s", 0, 4); err != nil || string(value) != "hello" {
+		t.Fatal(value, err)
+	}
+	var cmdErr *CommandError
+	if _, err := view.Incr("s"); !errors.As(err, &cmdErr) || cmdErr.Command != "incr" {
+		t.Fatal(err)
+	}
+}
+
+func TestStringMulti(t *testing.T) {
+	s, view := newTestView(t)
+	if err := view.MSet(map[string][]byte{"a": []byte("1"), "b": []byte("2")}); err != nil {
+		t.Fatal(err)
+	}
+	values, err := view.MGet("a", "none", "b")
+	if err != nil || !reflect.DeepEqual(values, [][]byte{[]byte("1"), nil, []byte("2")}) {
+		t.Fatal(values, err)
+	}
+	if ok, err := view.MSetNX(map[string][]byte{"a": []byte("x"), "c": []byte("3")}); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+	if s.Exists("TEST:dev:c") {
+		t.Fatal("msetnx wrote with an existing key")
+	}
+	if err := view.MSet(nil); err != ErrorInputValuesIsNil {
+		t.Fatal(err)
+	}
+	if old, err := view.GetSet("a", []byte("10")); err != nil || string(old) != "1" {
+		t.Fatal(old, err)
+	}
+	if value, err := view.GetDel("a"); err != nil || string(value) != "10" || s.Exists("TEST:dev:a") {
+		t.Fatal(value, err)
+	}
+	if _, err := view.GetDel("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+}
+
+func TestStringExpire(t *testing.T) {
+	s, view := newTestView(t)
+	view.SetDuration("k", []byte("v"), time.Minute)
+	if value, err := view.GetExDuration("k", time.Hour); err != nil || string(value) != "v" {
+		t.Fatal(value, err)
+	}
+	if ttl := s.TTL("TEST:dev:k"); ttl != time.Hour {
+		t.Fatal(ttl)
+	}
+	if _, err := view.GetExDuration("k", time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL("TEST:dev:k"); ttl != time.Millisecond {
+		t.Fatal("sub-millisecond ttl was not rounded up", ttl)
+	}
+	if _, err := view.GetEx("none", "1s"); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+
+	if ok, err := view.SetXXDuration("none", []byte("v"), time.Minute); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+	view.SetDuration("x", []byte("1"), time.Minute)
+	if ok, err := view.SetXXDuration("x", []byte("2"), 2*time.Minute); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if value, _ := s.Get("TEST:dev:x"); value != "2" || s.TTL("TEST:dev:x") != 2*time.Minute {
+		t.Fatal(value, s.TTL("TEST:dev:x"))
+	}
+	if ok, err := view.SetXX("none", []byte("v"), "1m"); err != nil || ok || s.Exists("TEST:dev:none") {
+		t.Fatal(ok, err)
+	}
+	if ok, err := view.SetXX("y", []byte("v"), "1x"); err == nil || ok {
+		t.Fatal("invalid duration", ok, err)
+	}
+	if ok, err := view.SetXX("x", []byte("4"), "30s"); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if value, _ := s.Get("TEST:dev:x"); value != "4" || s.TTL("TEST:dev:x") != 30*time.Second {
+		t.Fatal(value, s.TTL("TEST:dev:x"))
+	}
+	if ok, err := view.SetXXDuration("x", []byte("2"), 2*time.Minute); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if err := view.SetKeepTTL("x", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := s.Get("TEST:dev:x"); value != "3" || s.TTL("TEST:dev:x") != 2*time.Minute {
+		t.Fatal(value, s.TTL("TEST:dev:x"))
+	}
+}
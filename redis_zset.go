@@ -1,22 +1,41 @@
 package redisplus
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"gopkg.in/redis.v5"
+	"strconv"
+	"strings"
 )
 
 func (r *redisView) ZLen(key string) (int64, error) {
-	return r.cmd.ZCard(r.expandKey(key)).Result()
+	result, err := r.cmd.ZCard(r.expandKey(key)).Result()
+	if nil != err {
+		return 0, wrapError("zcard", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZCount(key string, min, max float64) (int64, error) {
-	return r.cmd.ZCount(r.expandKey(key),
+	result, err := r.cmd.ZCount(r.expandKey(key),
 		fmt.Sprintf("%f", min), fmt.Sprintf("%f", max)).Result()
+	if nil != err {
+		return 0, wrapError("zcount", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
+// ZLexCount 返回字典序范围内的 member 数量, min/max 使用 "[a", "(a", "-", "+" 的格式
 func (r *redisView) ZLexCount(key, min, max string) (int64, error) {
-	return 0, errors.New("not implemented")
+	cmd := redis.NewIntCmd("zlexcount", r.expandKey(key), min, max)
+	if err := r.cmd.Process(cmd); err != nil {
+		return 0, wrapError("zlexcount", r.expandKey(key), err)
+	}
+	result, err := cmd.Result()
+	if nil != err {
+		return 0, wrapError("zlexcount", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZAdd(key string, members ...*ZMember) (int64, error) {
@@ -28,7 +47,11 @@ func (r *redisView) ZAdd(key string, members ...*ZMember) (int64, error) {
 		}
 		zS = append(zS, z)
 	}
-	return r.cmd.ZAdd(r.expandKey(key), zS...).Result()
+	result, err := r.cmd.ZAdd(r.expandKey(key), zS...).Result()
+	if nil != err {
+		return 0, wrapError("zadd", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZRem(key string, members ...*ZMember) (int64, error) {
@@ -36,97 +59,279 @@ func (r *redisView) ZRem(key string, members ...*ZMember) (int64, error) {
 	for _, member := range members {
 		zS = append(zS, member.Member)
 	}
-	return r.cmd.ZRem(r.expandKey(key), zS...).Result()
+	result, err := r.cmd.ZRem(r.expandKey(key), zS...).Result()
+	if nil != err {
+		return 0, wrapError("zrem", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZRemRangeByLex(key, min, max string) (int64, error) {
-	return r.cmd.ZRemRangeByLex(r.expandKey(key), min, max).Result()
+	result, err := r.cmd.ZRemRangeByLex(r.expandKey(key), min, max).Result()
+	if nil != err {
+		return 0, wrapError("zremrangebylex", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZRemRangeByScore(key string, min, max float64) (int64, error) {
-	return r.cmd.ZRemRangeByScore(r.expandKey(key),
+	result, err := r.cmd.ZRemRangeByScore(r.expandKey(key),
 		fmt.Sprintf("%f", min), fmt.Sprintf("%f", max)).Result()
+	if nil != err {
+		return 0, wrapError("zremrangebyscore", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZRemRangeByRank(key string, start, stop int64) (int64, error) {
-	return r.cmd.ZRemRangeByRank(r.expandKey(key), start, stop).Result()
+	result, err := r.cmd.ZRemRangeByRank(r.expandKey(key), start, stop).Result()
+	if nil != err {
+		return 0, wrapError("zremrangebyrank", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
+// ZRange 按排名范围读取, withScores 为 false 时 ZMember.Score 为 0
 func (r *redisView) ZRange(key string, start, stop int64, reverse, withScores bool) ([]*ZMember, error) {
 	var err error
 	var members []string
 	var zSlice []redis.Z
-	if !reverse && !withScores {
-		members, err = r.cmd.ZRange(r.expandKey(key), start, stop).Result()
-	}
-	if reverse && withScores {
+	switch {
+	case reverse && withScores:
 		zSlice, err = r.cmd.ZRevRangeWithScores(r.expandKey(key), start, stop).Result()
-	}
-	if reverse {
+	case reverse:
 		members, err = r.cmd.ZRevRange(r.expandKey(key), start, stop).Result()
-	}
-	if withScores {
+	case withScores:
 		zSlice, err = r.cmd.ZRangeWithScores(r.expandKey(key), start, stop).Result()
+	default:
+		members, err = r.cmd.ZRange(r.expandKey(key), start, stop).Result()
+	}
+	result, err := toRangeZMembers(err, members, zSlice)
+	if nil != err {
+		return nil, wrapError("zrange", r.expandKey(key), err)
 	}
-	return toRangeZMembers(err, members, zSlice)
+	return result, nil
 }
 
+// ZRangeByScore 按分数范围读取, reverse 时按分数从高到低返回
 func (r *redisView) ZRangeByScore(key string, rangeBy ZRangeBy, reverse, withScores bool) ([]*ZMember, error) {
 	var err error
 	var members []string
 	var zSlice []redis.Z
-	if !reverse && !withScores {
-		members, err = r.cmd.ZRangeByScore(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
-	}
-	if reverse && withScores {
+	switch {
+	case reverse && withScores:
 		zSlice, err = r.cmd.ZRevRangeByScoreWithScores(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
-	}
-	if reverse {
+	case reverse:
 		members, err = r.cmd.ZRevRangeByScore(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
-	}
-	if withScores {
+	case withScores:
 		zSlice, err = r.cmd.ZRangeByScoreWithScores(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
+	default:
+		members, err = r.cmd.ZRangeByScore(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
+	}
+	result, err := toRangeZMembers(err, members, zSlice)
+	if nil != err {
+		return nil, wrapError("zrangebyscore", r.expandKey(key), err)
 	}
-	return toRangeZMembers(err, members, zSlice)
+	return result, nil
 }
 
+// ZRangeByLex 按字典序范围读取, Min/Max 使用 "[a", "(a", "-", "+" 的格式
 func (r *redisView) ZRangeByLex(key string, rangeBy ZRangeBy, reverse bool) ([]*ZMember, error) {
 	var err error
 	var members []string
 	if reverse {
-		members, err = r.cmd.ZRevRangeByLex(key, rangeBy.ToRedisRangeBy()).Result()
+		members, err = r.cmd.ZRevRangeByLex(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
+	} else {
+		members, err = r.cmd.ZRangeByLex(r.expandKey(key), rangeBy.ToRedisRangeBy()).Result()
 	}
-	members, err = r.cmd.ZRangeByLex(key, rangeBy.ToRedisRangeBy()).Result()
-	return toRangeZMembers(err, members, []redis.Z{})
+	result, err := toRangeZMembers(err, members, nil)
+	if nil != err {
+		return nil, wrapError("zrangebylex", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZRank(key string, member []byte, reverse bool) (int64, error) {
 	if reverse {
-		return r.cmd.ZRevRank(r.expandKey(key), string(member)).Result()
+		result, err := r.cmd.ZRevRank(r.expandKey(key), string(member)).Result()
+		if nil != err {
+			return 0, wrapError("zrevrank", r.expandKey(key), err)
+		}
+		return result, nil
 	}
-	return r.cmd.ZRank(r.expandKey(key), string(member)).Result()
+	result, err := r.cmd.ZRank(r.expandKey(key), string(member)).Result()
+	if nil != err {
+		return 0, wrapError("zrank", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZIncr(key string, member *ZMember) (float64, error) {
-	return r.cmd.ZIncr(r.expandKey(key), redis.Z{Score: member.Score, Member: member.Member}).Result()
+	result, err := r.cmd.ZIncr(r.expandKey(key), redis.Z{Score: member.Score, Member: member.Member}).Result()
+	if nil != err {
+		return 0, wrapError("zincrby", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
 func (r *redisView) ZIncrNX(key string, member *ZMember) (float64, error) {
-	return r.cmd.ZIncrNX(r.expandKey(key), redis.Z{Score: member.Score, Member: member.Member}).Result()
+	result, err := r.cmd.ZIncrNX(r.expandKey(key), redis.Z{Score: member.Score, Member: member.Member}).Result()
+	if nil != err {
+		return 0, wrapError("zadd", r.expandKey(key), err)
+	}
+	return result, nil
 }
 
+// ZInterMerge destination 与 keys 使用相同的前缀, 集群模式下必须在同一个 slot
 func (r *redisView) ZInterMerge(destination string, merge *ZMerge, keys ...string) (int64, error) {
-	var inKeys []string
-	for _, key := range keys {
-		inKeys = append(inKeys, r.expandKey(key))
+	dest, inKeys := r.expandKey(destination), r.expandKeys(keys)
+	if err := r.sameSlot(append([]string{dest}, inKeys...)...); err != nil {
+		return 0, err
+	}
+	result, err := r.cmd.ZInterStore(dest, merge.ToZStore(), inKeys...).Result()
+	if nil != err {
+		return 0, wrapError("zinterstore", dest, err)
 	}
-	return r.cmd.ZInterStore(destination, merge.ToZStore(), inKeys...).Result()
+	return result, nil
 }
 
+// ZUnionMerge destination 与 keys 使用相同的前缀, 集群模式下必须在同一个 slot
 func (r *redisView) ZUnionMerge(destination string, merge *ZMerge, keys ...string) (int64, error) {
-	var inKeys []string
-	for _, key := range keys {
-		inKeys = append(inKeys, r.expandKey(key))
+	dest, inKeys := r.expandKey(destination), r.expandKeys(keys)
+	if err := r.sameSlot(append([]string{dest}, inKeys...)...); err != nil {
+		return 0, err
+	}
+	result, err := r.cmd.ZUnionStore(dest, merge.ToZStore(), inKeys...).Result()
+	if nil != err {
+		return 0, wrapError("zunionstore", dest, err)
+	}
+	return result, nil
+}
+
+// ZScore member 不存在时返回 ErrNotFound
+func (r *redisView) ZScore(key string, member []byte) (float64, error) {
+	result, err := r.cmd.ZScore(r.expandKey(key), string(member)).Result()
+	if nil != err {
+		return 0, wrapError("zscore", r.expandKey(key), err)
+	}
+	return result, nil
+}
+
+// ZMScore 不存在的 member 对应的结果为 nil, 需要 redis 6.2
+func (r *redisView) ZMScore(key string, members ...[]byte) ([]*float64, error) {
+	args := []interface{}{"zmscore", r.expandKey(key)}
+	for _, member := range members {
+		args = append(args, member)
+	}
+	cmd := redis.NewSliceCmd(args...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("zmscore", r.expandKey(key), err)
+	}
+	out := make([]*float64, len(members))
+	for i, value := range cmd.Val() {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		score, err := strconv.ParseFloat(s, 64)
+		if nil != err {
+			return nil, wrapError("zmscore", r.expandKey(key), err)
+		}
+		out[i] = &score
+	}
+	return out, nil
+}
+
+// ZPopMin 弹出分数最低的 count 个 member, 需要 redis 5.0
+func (r *redisView) ZPopMin(key string, count int64) ([]*ZMember, error) {
+	return r.zPop("zpopmin", key, count)
+}
+
+// ZPopMax 弹出分数最高的 count 个 member, 需要 redis 5.0
+func (r *redisView) ZPopMax(key string, count int64) ([]*ZMember, error) {
+	return r.zPop("zpopmax", key, count)
+}
+
+func (r *redisView) zPop(command, key string, count int64) ([]*ZMember, error) {
+	cmd := redis.NewZSliceCmd(command, r.expandKey(key), count)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError(command, r.expandKey(key), err)
+	}
+	return toRangeZMembers(nil, nil, cmd.Val())
+}
+
+// BZPopMin 阻塞直到任一 key 非空或 ctx 结束, 从第一个非空的 key 中弹出分数最低的 member, 返回不带前缀的 key.
+// ctx 结束时返回 ctx.Err(), 最多延迟 1s 生效, 集群模式下 keys 必须在同一个 slot
+func (r *redisView) BZPopMin(ctx context.Context, keys ...string) (string, *ZMember, error) {
+	return r.bzPop(ctx, "bzpopmin", keys)
+}
+
+// BZPopMax 同 BZPopMin, 弹出分数最高的 member
+func (r *redisView) BZPopMax(ctx context.Context, keys ...string) (string, *ZMember, error) {
+	return r.bzPop(ctx, "bzpopmax", keys)
+}
+
+func (r *redisView) bzPop(ctx context.Context, command string, keys []string) (string, *ZMember, error) {
+	all := r.expandKeys(keys)
+	if err := r.sameSlot(all...); err != nil {
+		return "", nil, err
+	}
+	args := []interface{}{command}
+	for _, key := range all {
+		args = append(args, key)
+	}
+	args = append(args, blockingSeconds)
+	var cmd *redis.SliceCmd
+	err := blockingCall(ctx, func() error {
+		cmd = redis.NewSliceCmd(args...)
+		return r.cmd.Process(cmd)
+	})
+	if nil != err {
+		return "", nil, wrapError(command, strings.Join(all, " "), err)
+	}
+	result := cmd.Val()
+	if len(result) != 3 {
+		return "", nil, wrapError(command, strings.Join(all, " "), ErrorResultNotOK)
+	}
+	key, _ := result[0].(string)
+	member, _ := result[1].(string)
+	score, err := strconv.ParseFloat(fmt.Sprint(result[2]), 64)
+	if nil != err {
+		return "", nil, wrapError(command, key, err)
+	}
+	return r.truncateKey(key), &ZMember{Score: score, Member: []byte(member)}, nil
+}
+
+// ZRandMember 随机返回 count 个 member, count 为负数时允许重复, 需要 redis 6.2
+func (r *redisView) ZRandMember(key string, count int64, withScores bool) ([]*ZMember, error) {
+	args := []interface{}{"zrandmember", r.expandKey(key), count}
+	if !withScores {
+		cmd := redis.NewStringSliceCmd(args...)
+		if err := r.cmd.Process(cmd); err != nil {
+			return nil, wrapError("zrandmember", r.expandKey(key), err)
+		}
+		return toRangeZMembers(nil, cmd.Val(), nil)
+	}
+	cmd := redis.NewZSliceCmd(append(args, "withscores")...)
+	if err := r.cmd.Process(cmd); err != nil {
+		return nil, wrapError("zrandmember", r.expandKey(key), err)
+	}
+	return toRangeZMembers(nil, nil, cmd.Val())
+}
+
+// ZRangeStore 将 key 按排名范围的结果写入同一前缀下的 destination, 需要 redis 6.2
+func (r *redisView) ZRangeStore(destination, key string, start, stop int64) (int64, error) {
+	dest, src := r.expandKey(destination), r.expandKey(key)
+	if err := r.sameSlot(dest, src); err != nil {
+		return 0, err
+	}
+	cmd := redis.NewIntCmd("zrangestore", dest, src, start, stop)
+	if err := r.cmd.Process(cmd); err != nil {
+		return 0, wrapError("zrangestore", dest, err)
+	}
+	result, err := cmd.Result()
+	if nil != err {
+		return 0, wrapError("zrangestore", dest, err)
 	}
-	return r.cmd.ZUnionStore(destination, merge.ToZStore(), inKeys...).Result()
+	return result, nil
 }
@@ -0,0 +1,151 @@
+package redisplus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func zMembers(pairs ...interface{}) []*ZMember {
+	out := make([]*ZMember, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, &ZMember{Member: []byte(pairs[i].(string)), Score: pairs[i+1].(float64)})
+	}
+	return out
+}
+
+func TestZSetRange(t *testing.T) {
+	_, view := newTestView(t)
+	if _, err := view.ZAdd("z", zMembers("a", 1.0, "b", 2.0, "c", 3.0)...); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		call func() ([]*ZMember, error)
+		want []*ZMember
+	}{
+		{"range", func() ([]*ZMember, error) { return view.ZRange("z", 0, -1, false, false) },
+			zMembers("a", 0.0, "b", 0.0, "c", 0.0)},
+		{"range with scores", func() ([]*ZMember, error) { return view.ZRange("z", 0, 1, false, true) },
+			zMembers("a", 1.0, "b", 2.0)},
+		{"range reverse", func() ([]*ZMember, error) { return view.ZRange("z", 0, 0, true, false) },
+			zMembers("c", 0.0)},
+		{"range reverse with scores", func() ([]*ZMember, error) { return view.ZRange("z", 0, -1, true, true) },
+			zMembers("c", 3.0, "b", 2.0, "a", 1.0)},
+		{"by score", func() ([]*ZMember, error) {
+			return view.ZRangeByScore("z", ZRangeBy{Min: "2", Max: "+inf"}, false, true)
+		}, zMembers("b", 2.0, "c", 3.0)},
+		{"by score reverse", func() ([]*ZMember, error) {
+			return view.ZRangeByScore("z", ZRangeBy{Min: "-inf", Max: "(3"}, true, false)
+		}, zMembers("b", 0.0, "a", 0.0)},
+		{"by lex", func() ([]*ZMember, error) {
+			return view.ZRangeByLex("z", ZRangeBy{Min: "[b", Max: "+"}, false)
+		}, zMembers("b", 0.0, "c", 0.0)},
+		{"by lex reverse", func() ([]*ZMember, error) {
+			return view.ZRangeByLex("z", ZRangeBy{Min: "-", Max: "(c"}, true)
+		}, zMembers("b", 0.0, "a", 0.0)},
+		{"pop min", func() ([]*ZMember, error) { return view.ZPopMin("z", 1) },
+			zMembers("a", 1.0)},
+		{"pop max", func() ([]*ZMember, error) { return view.ZPopMax("z", 1) },
+			zMembers("c", 3.0)},
+		{"missing key", func() ([]*ZMember, error) { return view.ZRange("none", 0, -1, false, true) },
+			zMembers()},
+	}
+	for _, c := range cases {
+		got, err := c.call()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+//TestZSetRangeStore miniredis 不支持 ZRANGESTORE 时只检查发出的参数
+func TestZSetRangeStore(t *testing.T) {
+	s, view := newTestView(t)
+	view.ZAdd("z", zMembers("a", 1.0, "b", 2.0, "c", 3.0)...)
+	stub := stubCommand(s, "ZRANGESTORE", func(peer *server.Peer) { peer.WriteInt(2) })
+
+	if count, err := view.ZRangeStore("dest", "z", 0, 1); err != nil || count != 2 {
+		t.Fatal(count, err)
+	}
+	if stub != nil {
+		if args := stub.lastArgs(); !reflect.DeepEqual(args, []string{"TEST:dev:dest", "TEST:dev:z", "0", "1"}) {
+			t.Fatal("destination was not prefixed", args)
+		}
+	} else if got, _ := view.ZRange("dest", 0, -1, false, true); !reflect.DeepEqual(got, zMembers("a", 1.0, "b", 2.0)) {
+		t.Fatal(got)
+	}
+
+	//集群模式下 destination 与 key 必须在同一个 slot
+	view.(*redisView).cluster = true
+	if KeySlot("TEST:dev:dest") == KeySlot("TEST:dev:z") {
+		t.Fatal("test keys share a slot")
+	}
+	if _, err := view.ZRangeStore("dest", "z", 0, 1); err != ErrCrossSlot {
+		t.Fatal(err)
+	}
+	if _, err := view.ZRangeStore("{z}dest", "{z}", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZSetScore(t *testing.T) {
+	s, view := newTestView(t)
+	view.ZAdd("z", zMembers("a", 1.5, "b", 2.0, "c", 2.0)...)
+
+	if score, err := view.ZScore("z", []byte("a")); err != nil || score != 1.5 {
+		t.Fatal(score, err)
+	}
+	if _, err := view.ZScore("z", []byte("x")); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	scores, err := view.ZMScore("z", []byte("b"), []byte("x"))
+	if err != nil || len(scores) != 2 || scores[0] == nil || *scores[0] != 2 || scores[1] != nil {
+		t.Fatal(scores, err)
+	}
+	if count, err := view.ZLexCount("z", "[b", "+"); err != nil || count != 2 {
+		t.Fatal(count, err)
+	}
+	random, err := view.ZRandMember("z", 2, true)
+	if err != nil || len(random) != 2 || random[0].Score == 0 {
+		t.Fatal(random, err)
+	}
+
+	view.ZAdd("w", zMembers("a", 1.0)...)
+	if n, err := view.ZUnionMerge("u", &ZMerge{}, "z", "w"); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if !s.Exists("TEST:dev:u") || s.Exists("u") {
+		t.Fatal(s.Keys())
+	}
+	if score, _ := s.ZScore("TEST:dev:u", "a"); score != 2.5 {
+		t.Fatal(score)
+	}
+	if n, err := view.ZInterMerge("i", &ZMerge{}, "z", "w"); err != nil || n != 1 || !s.Exists("TEST:dev:i") {
+		t.Fatal(n, err, s.Keys())
+	}
+}
+
+func TestZSetBlockingPop(t *testing.T) {
+	_, view := newTestView(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := view.BZPopMin(ctx, "q1", "q2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		view.ZAdd("q2", zMembers("a", 1.0, "b", 2.0)...)
+	}()
+	key, member, err := view.BZPopMax(context.Background(), "q1", "q2")
+	if err != nil || key != "q2" || string(member.Member) != "b" || member.Score != 2 {
+		t.Fatal(key, member, err)
+	}
+}